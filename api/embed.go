@@ -0,0 +1,8 @@
+package api
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3 description of the /api/v1 JSON API
+//
+//go:embed openapi.yaml
+var OpenAPI []byte
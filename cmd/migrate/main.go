@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/config"
+	"github.com/ioverpi/personal-site/internal/database"
+	"github.com/ioverpi/personal-site/migrations"
+)
+
+func usage() {
+	fmt.Println("Usage: migrate [-dry-run] [-lock-timeout DURATION] <command> [args]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  status        List migrations and when each was applied")
+	fmt.Println("  up            Apply all pending migrations")
+	fmt.Println("  down [N]      Revert the N most recent migrations (default 1)")
+	fmt.Println("  to VERSION    Migrate up or down to VERSION (0 reverts everything)")
+	fmt.Println("  redo          Revert the most recent migration and apply it again")
+	fmt.Println("  verify        Compare the schema with one built from the migrations in a")
+	fmt.Println("                scratch database (needs permission to create databases)")
+	fmt.Println()
+	fmt.Println("With -dry-run, the SQL that would run is printed instead of run.")
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print the SQL instead of running it")
+	lockTimeout := flag.Duration("lock-timeout", 0, "how long to wait for another process that is migrating (default MIGRATION_LOCK_TIMEOUT_SECONDS)")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(1)
+	}
+
+	cfg := config.Load()
+
+	// Set migrations for database package
+	database.MigrationsFS = migrations.FS
+
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+	defer db.Close()
+
+	m, err := database.NewMigrator(db, migrations.FS)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	m.DryRun = *dryRun
+	m.Out = os.Stdout
+	m.LockTimeout = time.Duration(cfg.MigrationLockTimeoutSeconds) * time.Second
+	if *lockTimeout > 0 {
+		m.LockTimeout = *lockTimeout
+	}
+
+	ctx := context.Background()
+
+	// Changing migrations that have already run leaves the schema out of step
+	// with the files; warn before doing anything else
+	if err := database.CheckDrift(ctx, db); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	switch args[0] {
+	case "status":
+		err = status(ctx, m)
+	case "up":
+		var n int
+		n, err = m.Up(ctx)
+		report("Applied", n, *dryRun)
+	case "down":
+		count := 1
+		if len(args) > 1 {
+			count = parseNumber(args[1])
+		}
+		var n int
+		n, err = m.Down(ctx, count)
+		report("Reverted", n, *dryRun)
+	case "to":
+		if len(args) < 2 {
+			log.Fatal("Usage: migrate to VERSION")
+		}
+		err = m.To(ctx, parseNumber(args[1]))
+	case "redo":
+		err = m.Redo(ctx)
+	case "verify":
+		err = verify(ctx, db, cfg.DatabaseURL)
+	default:
+		usage()
+		os.Exit(1)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func status(ctx context.Context, m *database.Migrator) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATUS\tAPPLIED AT\tFILE")
+	for _, s := range statuses {
+		state, appliedAt := "pending", "-"
+		if s.IsApplied() {
+			state = "applied"
+			appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		if s.Modified {
+			state = "modified"
+		}
+		if s.Missing {
+			state = "missing file"
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", s.Version, state, appliedAt, s.Filename)
+	}
+	return w.Flush()
+}
+
+func verify(ctx context.Context, db *sql.DB, databaseURL string) error {
+	diff, err := database.Verify(ctx, db, databaseURL, migrations.FS)
+	if err != nil {
+		return err
+	}
+	if diff.IsEmpty() {
+		fmt.Println("Schema matches the applied migrations")
+		return nil
+	}
+
+	for _, line := range diff.Missing {
+		fmt.Println("- " + line)
+	}
+	for _, line := range diff.Unexpected {
+		fmt.Println("+ " + line)
+	}
+	return fmt.Errorf("schema differs from the applied migrations: %d missing (-), %d unexpected (+)",
+		len(diff.Missing), len(diff.Unexpected))
+}
+
+func report(verb string, n int, dryRun bool) {
+	if dryRun {
+		return
+	}
+	log.Printf("%s %d migration(s)", verb, n)
+}
+
+func parseNumber(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		log.Fatalf("Invalid number: %s", s)
+	}
+	return n
+}
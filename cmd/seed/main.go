@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"github.com/ioverpi/personal-site/internal/app"
 	"github.com/ioverpi/personal-site/internal/config"
 	"github.com/ioverpi/personal-site/internal/database"
+	"github.com/ioverpi/personal-site/internal/models"
 	"github.com/ioverpi/personal-site/internal/services"
 	"github.com/ioverpi/personal-site/migrations"
 )
@@ -23,16 +25,13 @@ func main() {
 	name := os.Args[2]
 	password := os.Args[3]
 
-	if len(password) < 8 {
-		log.Fatal("Password must be at least 8 characters")
-	}
-
 	cfg := config.Load()
 
 	// Set migrations for database package
 	database.MigrationsFS = migrations.FS
 
-	application, err := app.New(cfg)
+	ctx := context.Background()
+	application, err := app.New(ctx, cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize app: %v", err)
 	}
@@ -41,11 +40,16 @@ func main() {
 	authService := services.NewAuthService(application)
 	userService := services.NewUserService(application)
 
+	if err := authService.CheckNewPassword(ctx, password, email, name); err != nil {
+		log.Fatalf("Password rejected: %v (at least %d characters, not common, breached or your name/email)",
+			err, services.MinPasswordLength)
+	}
+
 	// Check if user already exists
-	existing, _ := userService.GetByEmail(email)
+	existing, _ := userService.GetByEmail(ctx, email)
 	if existing != nil {
 		log.Println("User already exists. Updating password...")
-		if err := authService.UpdatePassword(existing.ID, password); err != nil {
+		if err := authService.UpdatePassword(ctx, existing.ID, password); err != nil {
 			log.Fatalf("Failed to update password: %v", err)
 		}
 		log.Println("Password updated successfully!")
@@ -53,17 +57,17 @@ func main() {
 	}
 
 	// Create user
-	user, err := userService.CreateUser(services.CreateUserInput{
+	user, err := userService.CreateUser(ctx, services.CreateUserInput{
 		Email: email,
 		Name:  name,
-		Role:  "admin",
+		Role:  models.RoleAdmin,
 	})
 	if err != nil {
 		log.Fatalf("Failed to create user: %v", err)
 	}
 
 	// Create login
-	_, err = authService.CreatePasswordLogin(user.ID, email, password)
+	_, err = authService.CreatePasswordLogin(ctx, user.ID, email, password)
 	if err != nil {
 		log.Fatalf("Failed to create login: %v", err)
 	}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,12 +12,18 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	apidocs "github.com/ioverpi/personal-site/api"
 	"github.com/ioverpi/personal-site/internal/app"
 	"github.com/ioverpi/personal-site/internal/config"
 	"github.com/ioverpi/personal-site/internal/controllers"
 	"github.com/ioverpi/personal-site/internal/database"
+	"github.com/ioverpi/personal-site/internal/health"
+	"github.com/ioverpi/personal-site/internal/metrics"
 	"github.com/ioverpi/personal-site/internal/middleware"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/scheduler"
 	"github.com/ioverpi/personal-site/internal/services"
+	"github.com/ioverpi/personal-site/internal/tracing"
 	"github.com/ioverpi/personal-site/migrations"
 )
 
@@ -32,10 +40,22 @@ func main() {
 	}
 	slog.SetDefault(slog.New(handler))
 
+	// Tracing, before anything that could start a span
+	exporter, err := tracing.NewExporter(context.Background(), cfg.TracesExporter)
+	if err != nil {
+		slog.Error("failed to create trace exporter", "error", err)
+		os.Exit(1)
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), exporter)
+	if err != nil {
+		slog.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
 	// Set migrations for database package
 	database.MigrationsFS = migrations.FS
 
-	application, err := app.New(cfg)
+	application, err := app.New(context.Background(), cfg)
 	if err != nil {
 		slog.Error("failed to initialize app", "error", err)
 		os.Exit(1)
@@ -45,9 +65,12 @@ func main() {
 	// Use Gin without default middleware, add our own
 	r := gin.New()
 	r.Use(gin.Recovery())
+	r.Use(middleware.Tracing())
 	r.Use(middleware.RequestID())
 	r.Use(middleware.Logger())
+	r.Use(middleware.Metrics())
 	r.Use(middleware.SecurityHeaders())
+	r.Use(middleware.CSRF(csrfSecret(cfg), cfg.SecureCookies))
 
 	// Static files
 	r.Static("/static", "./static")
@@ -59,10 +82,37 @@ func main() {
 	adminService := services.NewAdminService(application)
 	authService := services.NewAuthService(application)
 	userService := services.NewUserService(application)
+	apiTokenService := services.NewAPITokenService(application)
+	auditService := services.NewAuditService(application)
+
+	// Background jobs
+	sched := scheduler.New(application.Repos.JobRuns)
+	if err := registerJobs(sched, authService, adminService); err != nil {
+		slog.Error("failed to register jobs", "error", err)
+		os.Exit(1)
+	}
+
+	// Health checks. Liveness only covers this process; readiness adds the
+	// database it needs to serve requests.
+	// The migration files are loaded once, so each check only asks the
+	// database which have run.
+	migrator, err := database.NewMigrator(application.DB, migrations.FS)
+	if err != nil {
+		slog.Error("failed to load migrations", "error", err)
+		os.Exit(1)
+	}
+	checker := health.New(time.Duration(cfg.HealthCheckTimeoutSeconds) * time.Second)
+	checker.AddReadiness("database", application.DB.PingContext)
+	checker.AddReadiness("migrations", migrator.CheckPending)
+	// A stuck job shouldn't get the server restarted mid-run, so the
+	// scheduler only affects readiness
+	checker.AddReadiness("scheduler", sched.CheckHeartbeat)
 
 	// Controllers
+	healthCtrl := controllers.NewHealthController(checker)
 	homeCtrl := controllers.NewHomeController()
 	blogCtrl := controllers.NewBlogController(blogService)
+	authorsCtrl := controllers.NewAuthorsController(userService, blogService)
 	projectsCtrl := controllers.NewProjectsController(projectsService)
 	quotesCtrl := controllers.NewQuotesController(quotesService)
 	adminCtrl := controllers.NewAdminController(
@@ -72,18 +122,31 @@ func main() {
 		quotesService,
 		authService,
 		userService,
+		apiTokenService,
+		auditService,
 		cfg,
 	)
+	apiCtrl := controllers.NewAPIController(
+		adminService,
+		blogService,
+		projectsService,
+		quotesService,
+		auditService,
+	)
 
-	// Health check
+	// Health checks. /health only shows the server is up and is kept for
+	// existing monitors.
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
+	r.GET("/livez", healthCtrl.Live)
+	r.GET("/readyz", healthCtrl.Ready)
 
 	// Public routes
 	r.GET("/", homeCtrl.Index)
 	r.GET("/blog", blogCtrl.List)
 	r.GET("/blog/:slug", blogCtrl.Show)
+	r.GET("/authors/:slug", authorsCtrl.Show)
 	r.GET("/projects", projectsCtrl.List)
 	r.GET("/projects/last-game-of-2020", projectsCtrl.LastGameOf2020)
 	r.GET("/quotes", quotesCtrl.List)
@@ -99,51 +162,152 @@ func main() {
 	// Admin auth routes (no auth required, but rate limited)
 	r.GET("/admin/login", adminCtrl.LoginPage)
 	r.POST("/admin/login", middleware.RateLimitMiddleware(authLimiter), adminCtrl.Login)
+	r.POST("/admin/login/link", middleware.RateLimitMiddleware(authLimiter), adminCtrl.RequestLoginLink)
+	r.GET("/admin/login/link/confirm", adminCtrl.LoginLinkPage)
+	r.POST("/admin/login/link/confirm", middleware.RateLimitMiddleware(authLimiter), adminCtrl.LoginWithLink)
+
+	// OAuth sign-in with a linked account, and the callback shared with linking
+	r.GET("/auth/:provider", adminCtrl.OAuthLogin)
+	r.GET("/auth/:provider/callback", middleware.RateLimitMiddleware(authLimiter), adminCtrl.OAuthCallback)
+
+	// Email change confirmation (from the emailed link, may be on another device)
+	r.GET("/admin/account/email/confirm", adminCtrl.EmailChangePage)
+	r.POST("/admin/account/email/confirm", middleware.RateLimitMiddleware(authLimiter), adminCtrl.ConfirmEmailChange)
 
 	// Protected admin routes
 	admin := r.Group("/admin")
 	admin.Use(middleware.AuthMiddleware(authService, cfg.SecureCookies))
 	{
 		admin.GET("/logout", adminCtrl.Logout)
-		admin.GET("/", adminCtrl.Dashboard)
+		admin.POST("/impersonate/stop", adminCtrl.StopImpersonating)
+		admin.GET("/", middleware.RequirePermission(models.PermViewDashboard), adminCtrl.Dashboard)
+
+		// Credential and sign-in changes are left to the account owner, so
+		// they are blocked while an admin is viewing as the user
+		ownerOnly := middleware.BlockWhileImpersonating()
+
+		// Profile
+		admin.GET("/profile", adminCtrl.Profile)
+		admin.POST("/profile", adminCtrl.UpdateProfile)
+		admin.POST("/profile/magic-link", ownerOnly, adminCtrl.SetMagicLink)
+
+		// Account settings (scoped to the current user)
+		admin.GET("/account", adminCtrl.Account)
+		admin.POST("/account/name", adminCtrl.UpdateName)
+		admin.POST("/account/email", ownerOnly, adminCtrl.RequestEmailChange)
+		admin.POST("/account/password", ownerOnly, adminCtrl.ChangePassword)
+		admin.POST("/account/connect/:provider", ownerOnly, adminCtrl.ConnectLogin)
+		admin.POST("/account/logins/:id/unlink", ownerOnly, adminCtrl.UnlinkLogin)
+		admin.POST("/account/delete", ownerOnly, adminCtrl.DeleteAccount)
+
+		// Sessions (scoped to the current user)
+		admin.GET("/sessions", adminCtrl.Sessions)
+		admin.POST("/sessions/:id/revoke", ownerOnly, adminCtrl.RevokeSession)
+		admin.POST("/sessions/revoke-others", ownerOnly, adminCtrl.RevokeOtherSessions)
+
+		// API tokens (scoped to the current user)
+		admin.GET("/tokens", adminCtrl.APITokens)
+		admin.POST("/tokens", ownerOnly, adminCtrl.CreateAPIToken)
+		admin.POST("/tokens/:id/revoke", ownerOnly, adminCtrl.RevokeAPIToken)
 
 		// Users (admin only)
-		admin.GET("/users", adminCtrl.UsersList)
-		admin.GET("/invites/new", adminCtrl.NewInvite)
-		admin.POST("/invites", adminCtrl.CreateInvite)
-		admin.POST("/invites/:id/delete", adminCtrl.DeleteInvite)
-
-		// Posts
-		admin.GET("/posts/new", adminCtrl.NewPost)
-		admin.POST("/posts", adminCtrl.CreatePost)
-		admin.GET("/posts/:id/edit", adminCtrl.EditPost)
-		admin.POST("/posts/:id", adminCtrl.UpdatePost)
-		admin.POST("/posts/:id/delete", adminCtrl.DeletePost)
+		manageUsers := middleware.RequirePermission(models.PermManageUsers)
+		manageInvites := middleware.RequirePermission(models.PermManageInvites)
+		admin.GET("/users", manageUsers, adminCtrl.UsersList)
+		admin.POST("/users/:id/unlock", manageUsers, adminCtrl.UnlockUser)
+		admin.POST("/users/:id/role", manageUsers, adminCtrl.ChangeUserRole)
+		admin.POST("/users/:id/deactivate", manageUsers, adminCtrl.DeactivateUser)
+		admin.POST("/users/:id/reactivate", manageUsers, adminCtrl.ReactivateUser)
+		admin.GET("/users/:id/delete", manageUsers, adminCtrl.ConfirmDeleteUser)
+		admin.POST("/users/:id/delete", manageUsers, adminCtrl.DeleteUser)
+		admin.POST("/users/:id/impersonate", manageUsers, adminCtrl.ImpersonateUser)
+		admin.GET("/invites/new", manageInvites, adminCtrl.NewInvite)
+		admin.POST("/invites", manageInvites, adminCtrl.CreateInvite)
+		admin.GET("/invites", manageInvites, adminCtrl.InviteHistory)
+		admin.POST("/invites/:id/resend", manageInvites, adminCtrl.ResendInvite)
+		admin.POST("/invites/:id/revoke", manageInvites, adminCtrl.RevokeInvite)
+
+		// Audit log
+		viewAudit := middleware.RequirePermission(models.PermViewAuditLog)
+		admin.GET("/audit", viewAudit, adminCtrl.AuditLog)
+		admin.GET("/audit/export.csv", viewAudit, adminCtrl.ExportAuditLog)
+
+		// Posts (authors may only edit their own; checked in the controller)
+		createPosts := middleware.RequirePermission(models.PermCreatePosts)
+		editPosts := middleware.RequirePermission(models.PermEditOwnPosts)
+		admin.GET("/posts/new", createPosts, adminCtrl.NewPost)
+		admin.POST("/posts", createPosts, adminCtrl.CreatePost)
+		admin.GET("/posts/:id/edit", editPosts, adminCtrl.EditPost)
+		admin.POST("/posts/:id", editPosts, adminCtrl.UpdatePost)
+		admin.POST("/posts/:id/delete", editPosts, adminCtrl.DeletePost)
 
 		// Projects
-		admin.GET("/projects/new", adminCtrl.NewProject)
-		admin.POST("/projects", adminCtrl.CreateProject)
-		admin.GET("/projects/:id/edit", adminCtrl.EditProject)
-		admin.POST("/projects/:id", adminCtrl.UpdateProject)
-		admin.POST("/projects/:id/delete", adminCtrl.DeleteProject)
+		manageProjects := middleware.RequirePermission(models.PermManageProjects)
+		admin.GET("/projects/new", manageProjects, adminCtrl.NewProject)
+		admin.POST("/projects", manageProjects, adminCtrl.CreateProject)
+		admin.GET("/projects/:id/edit", manageProjects, adminCtrl.EditProject)
+		admin.POST("/projects/:id", manageProjects, adminCtrl.UpdateProject)
+		admin.POST("/projects/:id/delete", manageProjects, adminCtrl.DeleteProject)
 
 		// Quotes
-		admin.GET("/quotes/new", adminCtrl.NewQuote)
-		admin.POST("/quotes", adminCtrl.CreateQuote)
-		admin.GET("/quotes/:id/edit", adminCtrl.EditQuote)
-		admin.POST("/quotes/:id", adminCtrl.UpdateQuote)
-		admin.POST("/quotes/:id/delete", adminCtrl.DeleteQuote)
+		manageQuotes := middleware.RequirePermission(models.PermManageQuotes)
+		admin.GET("/quotes/new", manageQuotes, adminCtrl.NewQuote)
+		admin.POST("/quotes", manageQuotes, adminCtrl.CreateQuote)
+		admin.GET("/quotes/:id/edit", manageQuotes, adminCtrl.EditQuote)
+		admin.POST("/quotes/:id", manageQuotes, adminCtrl.UpdateQuote)
+		admin.POST("/quotes/:id/delete", manageQuotes, adminCtrl.DeleteQuote)
+	}
+
+	// JSON API (bearer token auth)
+	r.GET("/api/v1/openapi.yaml", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/yaml", apidocs.OpenAPI)
+	})
+
+	api := r.Group("/api/v1")
+	api.Use(middleware.APITokenAuth(apiTokenService))
+	{
+		api.GET("/me", apiCtrl.Me)
+
+		readPosts := middleware.RequireScope(models.ScopePostsRead)
+		writePosts := middleware.RequireScope(models.ScopePostsWrite)
+		api.GET("/posts", readPosts, apiCtrl.ListPosts)
+		api.GET("/posts/:id", readPosts, apiCtrl.GetPost)
+		api.POST("/posts", writePosts, apiCtrl.CreatePost)
+		api.PUT("/posts/:id", writePosts, apiCtrl.UpdatePost)
+		api.DELETE("/posts/:id", writePosts, apiCtrl.DeletePost)
+
+		readProjects := middleware.RequireScope(models.ScopeProjectsRead)
+		writeProjects := middleware.RequireScope(models.ScopeProjectsWrite)
+		api.GET("/projects", readProjects, apiCtrl.ListProjects)
+		api.GET("/projects/:id", readProjects, apiCtrl.GetProject)
+		api.POST("/projects", writeProjects, apiCtrl.CreateProject)
+		api.PUT("/projects/:id", writeProjects, apiCtrl.UpdateProject)
+		api.DELETE("/projects/:id", writeProjects, apiCtrl.DeleteProject)
+
+		readQuotes := middleware.RequireScope(models.ScopeQuotesRead)
+		writeQuotes := middleware.RequireScope(models.ScopeQuotesWrite)
+		api.GET("/quotes", readQuotes, apiCtrl.ListQuotes)
+		api.GET("/quotes/:id", readQuotes, apiCtrl.GetQuote)
+		api.POST("/quotes", writeQuotes, apiCtrl.CreateQuote)
+		api.PUT("/quotes/:id", writeQuotes, apiCtrl.UpdateQuote)
+		api.DELETE("/quotes/:id", writeQuotes, apiCtrl.DeleteQuote)
 	}
 
-	// Create server with timeouts
+	// Create server with timeouts. Request contexts derive from baseCtx, so
+	// cancelling it cancels their database queries.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 	srv := &http.Server{
 		Addr:         ":" + cfg.Port,
 		Handler:      r,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		BaseContext:  func(net.Listener) context.Context { return baseCtx },
 	}
 
+	sched.Start()
+
 	// Start server in goroutine
 	go func() {
 		slog.Info("server starting", "port", cfg.Port)
@@ -153,20 +317,139 @@ func main() {
 		}
 	}()
 
+	// Metrics get their own listener, so they aren't public with the site
+	var metricsSrv *http.Server
+	if cfg.MetricsAddr != "" {
+		if err := metrics.RegisterDB(application.DB, "main"); err != nil {
+			slog.Error("failed to register database metrics", "error", err)
+			os.Exit(1)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsSrv = &http.Server{
+			Addr:         cfg.MetricsAddr,
+			Handler:      mux,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		go func() {
+			slog.Info("metrics server starting", "addr", cfg.MetricsAddr)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("failed to start metrics server", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	slog.Info("shutting down server")
 
-	// Give outstanding requests 10 seconds to complete
+	// Fail readiness first and keep serving while load balancers notice
+	checker.Drain()
+	if cfg.ShutdownDrainSeconds > 0 {
+		slog.Info("draining", "seconds", cfg.ShutdownDrainSeconds)
+		time.Sleep(time.Duration(cfg.ShutdownDrainSeconds) * time.Second)
+	}
+
+	// Give outstanding requests and running jobs 10 seconds to complete, then
+	// cancel whatever they are still waiting on
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	context.AfterFunc(ctx, cancelRequests)
+
+	schedDone := make(chan error, 1)
+	go func() { schedDone <- sched.Stop(ctx) }()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		slog.Error("server forced to shutdown", "error", err)
 		os.Exit(1)
 	}
+	if err := <-schedDone; err != nil {
+		slog.Error("scheduler forced to stop", "error", err)
+	}
+
+	// Metrics stay up until the end so the shutdown itself is scraped
+	if metricsSrv != nil {
+		metricsSrv.Close()
+	}
+
+	// Send the last spans, with a fresh deadline as ctx may have run out
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
 
 	slog.Info("server exited")
 }
+
+// registerJobs adds the periodic maintenance jobs
+func registerJobs(sched *scheduler.Scheduler, auth *services.AuthService, admin *services.AdminService) error {
+	jobs := []struct {
+		name, spec string
+		run        func(ctx context.Context) error
+	}{
+		{"session-cleanup", "*/15 * * * *", func(ctx context.Context) error {
+			if err := auth.CleanExpiredSessions(ctx); err != nil {
+				return err
+			}
+			return auth.CleanExpiredLoginLinks(ctx)
+		}},
+		{"invite-cleanup", "30 3 * * *", func(ctx context.Context) error {
+			removed, err := auth.CleanExpiredInvites(ctx, 30*24*time.Hour)
+			if removed > 0 {
+				slog.Info("removed expired invites", "count", removed)
+			}
+			return err
+		}},
+		{"login-attempt-cleanup", "15 4 * * *", func(ctx context.Context) error {
+			removed, err := auth.CleanLoginAttempts(ctx, 30*24*time.Hour)
+			if removed > 0 {
+				slog.Info("removed old login attempts", "count", removed)
+			}
+			return err
+		}},
+		{"scheduled-publishing", "* * * * *", func(ctx context.Context) error {
+			published, err := admin.PublishScheduledPosts(ctx)
+			if published > 0 {
+				slog.Info("published scheduled posts", "count", published)
+			}
+			return err
+		}},
+		{"job-history-cleanup", "45 3 * * *", func(ctx context.Context) error {
+			return sched.PruneHistory(ctx, 30*24*time.Hour)
+		}},
+	}
+
+	for _, j := range jobs {
+		if err := sched.Add(j.name, j.spec, j.run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csrfSecret returns the key used to sign CSRF tokens. Without SECRET_KEY a
+// random key is generated, so open forms stop working after a restart and
+// replicas reject each other's tokens. Production refuses to start without it.
+func csrfSecret(cfg *config.Config) []byte {
+	if cfg.SecretKey != "" {
+		return []byte(cfg.SecretKey)
+	}
+	if cfg.Environment == "production" {
+		slog.Error("SECRET_KEY must be set in production")
+		os.Exit(1)
+	}
+
+	slog.Warn("SECRET_KEY is not set; using a random key for CSRF tokens")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		slog.Error("failed to generate CSRF key", "error", err)
+		os.Exit(1)
+	}
+	return key
+}
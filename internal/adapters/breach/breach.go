@@ -0,0 +1,111 @@
+// Package breach checks passwords against breach corpora using the
+// k-anonymity range API popularised by Pwned Passwords: only the first five
+// hex characters of the password's SHA-1 hash leave the server.
+package breach
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Checker reports how many times a password appears in known breaches
+type Checker interface {
+	Count(ctx context.Context, password string) (int, error)
+}
+
+// RangeClient queries a range API at BaseURL + "/range/{prefix}"
+type RangeClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewRangeClient(baseURL string) *RangeClient {
+	return &RangeClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (c *RangeClient) Count(ctx context.Context, password string) (int, error) {
+	prefix, suffix := hashParts(password)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/range/"+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+	// Padding hides the real size of the response from observers
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("breach range API returned %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		hashSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(hashSuffix, suffix) {
+			continue
+		}
+		// Padding entries have a count of 0
+		return strconv.Atoi(count)
+	}
+	return 0, scanner.Err()
+}
+
+// Local is an in-memory stand-in for the range API, keyed by upper-case SHA-1
+// hash. It can be used directly as a Checker, or served over HTTP for a
+// RangeClient to query in development.
+type Local map[string]int
+
+// NewLocal returns a Local that reports each given password as breached once
+func NewLocal(passwords ...string) Local {
+	l := Local{}
+	for _, password := range passwords {
+		prefix, suffix := hashParts(password)
+		l[prefix+suffix]++
+	}
+	return l
+}
+
+func (l Local) Count(_ context.Context, password string) (int, error) {
+	prefix, suffix := hashParts(password)
+	return l[prefix+suffix], nil
+}
+
+// ServeHTTP answers GET /range/{prefix} in the range API's format
+func (l Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix, ok := strings.CutPrefix(r.URL.Path, "/range/")
+	if !ok || len(prefix) != 5 {
+		http.NotFound(w, r)
+		return
+	}
+	prefix = strings.ToUpper(prefix)
+
+	w.Header().Set("Content-Type", "text/plain")
+	for hash, count := range l {
+		if strings.HasPrefix(hash, prefix) {
+			fmt.Fprintf(w, "%s:%d\r\n", hash[5:], count)
+		}
+	}
+}
+
+// hashParts splits the password's upper-case SHA-1 hex digest into the
+// five-character prefix sent to the API and the suffix matched locally
+func hashParts(password string) (prefix, suffix string) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return digest[:5], digest[5:]
+}
@@ -0,0 +1,175 @@
+// Package oauth implements the OAuth 2 authorization code flow for the
+// providers users can link to their account.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrNoIdentity = errors.New("provider did not return a user id")
+
+// Identity is the provider's account for the signed-in user
+type Identity struct {
+	ID    string
+	Email string
+}
+
+// Provider holds the endpoints and credentials for one OAuth provider
+type Provider struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	Scopes       []string
+
+	// identity extracts the account from the provider's user info response
+	identity func(body []byte) (Identity, error)
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+func NewGoogle(clientID, clientSecret string) *Provider {
+	return &Provider{
+		Name:         "google",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:     "https://oauth2.googleapis.com/token",
+		UserInfoURL:  "https://openidconnect.googleapis.com/v1/userinfo",
+		Scopes:       []string{"openid", "email"},
+		identity: func(body []byte) (Identity, error) {
+			var info struct {
+				Sub   string `json:"sub"`
+				Email string `json:"email"`
+			}
+			if err := json.Unmarshal(body, &info); err != nil {
+				return Identity{}, err
+			}
+			return Identity{ID: info.Sub, Email: info.Email}, nil
+		},
+	}
+}
+
+func NewGitHub(clientID, clientSecret string) *Provider {
+	return &Provider{
+		Name:         "github",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AuthURL:      "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		UserInfoURL:  "https://api.github.com/user",
+		Scopes:       []string{"read:user"},
+		identity: func(body []byte) (Identity, error) {
+			var info struct {
+				ID    json.Number `json:"id"`
+				Email string      `json:"email"`
+			}
+			if err := json.Unmarshal(body, &info); err != nil {
+				return Identity{}, err
+			}
+			return Identity{ID: info.ID.String(), Email: info.Email}, nil
+		},
+	}
+}
+
+// AuthCodeURL is where to send the user to approve access
+func (p *Provider) AuthCodeURL(state, redirectURL string) string {
+	params := url.Values{
+		"client_id":     {p.ClientID},
+		"redirect_uri":  {redirectURL},
+		"response_type": {"code"},
+		"scope":         {strings.Join(p.Scopes, " ")},
+		"state":         {state},
+	}
+	return p.AuthURL + "?" + params.Encode()
+}
+
+// Identify exchanges the authorization code from the callback and looks up
+// the provider account it belongs to.
+func (p *Provider) Identify(ctx context.Context, code, redirectURL string) (Identity, error) {
+	accessToken, err := p.exchange(ctx, code, redirectURL)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.UserInfoURL, nil)
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	body, err := do(req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%s user info: %w", p.Name, err)
+	}
+
+	identity, err := p.identity(body)
+	if err != nil {
+		return Identity{}, err
+	}
+	if identity.ID == "" {
+		return Identity{}, ErrNoIdentity
+	}
+	return identity, nil
+}
+
+func (p *Provider) exchange(ctx context.Context, code, redirectURL string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	body, err := do(req)
+	if err != nil {
+		return "", fmt.Errorf("%s token exchange: %w", p.Name, err)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("%s token exchange: %s", p.Name, token.Error)
+	}
+	return token.AccessToken, nil
+}
+
+func do(req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return body, nil
+}
@@ -1,33 +1,116 @@
 package app
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
 
+	"github.com/ioverpi/personal-site/internal/adapters/breach"
+	"github.com/ioverpi/personal-site/internal/adapters/mail"
+	"github.com/ioverpi/personal-site/internal/adapters/oauth"
 	"github.com/ioverpi/personal-site/internal/config"
 	"github.com/ioverpi/personal-site/internal/database"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/repository"
+	"github.com/ioverpi/personal-site/internal/repository/sqlstore"
 )
 
 type App struct {
 	DB     *sql.DB
+	Repos  *repository.Repositories // Backed by DB, for whichever database it is
 	Config *config.Config
+	Mailer mail.Mailer
+	OAuth  map[string]*oauth.Provider // Configured providers, keyed by name
+
+	// Breaches checks new passwords against a breach range API; nil when
+	// none is configured
+	Breaches breach.Checker
+
+	driver       string
+	queryTimeout time.Duration
 }
 
-func New(cfg *config.Config) (*App, error) {
+func New(ctx context.Context, cfg *config.Config) (*App, error) {
 	db, err := database.Connect(cfg.DatabaseURL)
 	if err != nil {
 		return nil, err
 	}
 
-	// Run pending migrations
-	if err := database.Migrate(db); err != nil {
+	// Refuse to run against a schema built from different migration files
+	if err := database.CheckDrift(ctx, db); err != nil {
+		if !errors.Is(err, database.ErrMigrationDrift) || cfg.MigrationDrift != "warn" {
+			db.Close()
+			return nil, err
+		}
+		slog.Warn("migration files differ from the applied migrations", "error", err)
+	}
+
+	// Run pending migrations, or make sure they've been run
+	if cfg.AutoMigrate {
+		err = database.Migrate(ctx, db, time.Duration(cfg.MigrationLockTimeoutSeconds)*time.Second)
+	} else {
+		err = database.CheckMigrations(ctx, db)
+	}
+	if err != nil {
 		db.Close()
 		return nil, err
 	}
 
-	return &App{
+	a := &App{
 		DB:     db,
 		Config: cfg,
-	}, nil
+		Mailer: newMailer(cfg),
+		OAuth:  newOAuthProviders(cfg),
+
+		Breaches: newBreachChecker(cfg),
+
+		driver:       database.Driver(db),
+		queryTimeout: time.Duration(cfg.QueryTimeoutSeconds) * time.Second,
+	}
+	a.Repos = a.newRepositories(db)
+	return a, nil
+}
+
+// InTx runs fn with repositories that share one transaction, committing it
+// if fn returns nil and rolling it back otherwise. fn must only use the
+// repositories it is given: on SQLite the transaction holds the only
+// connection, so a.Repos would wait for it to finish.
+func (a *App) InTx(ctx context.Context, fn func(repos *repository.Repositories) error) error {
+	return database.InTx(ctx, a.DB, func(tx *sql.Tx) error {
+		return fn(a.newRepositories(tx))
+	})
+}
+
+func (a *App) newRepositories(q database.Queryer) *repository.Repositories {
+	return sqlstore.New(database.Traced(q, a.driver), a.driver, a.queryTimeout)
+}
+
+func newMailer(cfg *config.Config) mail.Mailer {
+	if cfg.SMTPHost == "" {
+		return mail.LogMailer{}
+	}
+	return mail.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+}
+
+// newOAuthProviders returns the providers that have credentials configured
+func newOAuthProviders(cfg *config.Config) map[string]*oauth.Provider {
+	providers := map[string]*oauth.Provider{}
+	if cfg.GoogleClientID != "" {
+		providers[models.ProviderGoogle] = oauth.NewGoogle(cfg.GoogleClientID, cfg.GoogleClientSecret)
+	}
+	if cfg.GitHubClientID != "" {
+		providers[models.ProviderGitHub] = oauth.NewGitHub(cfg.GitHubClientID, cfg.GitHubClientSecret)
+	}
+	return providers
+}
+
+func newBreachChecker(cfg *config.Config) breach.Checker {
+	if cfg.BreachedPasswordsURL == "" {
+		return nil
+	}
+	return breach.NewRangeClient(cfg.BreachedPasswordsURL)
 }
 
 func (a *App) Close() {
@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ioverpi/personal-site/internal/middleware"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/services"
+	"github.com/ioverpi/personal-site/templates/pages/admin"
+)
+
+// Account settings: the signed-in user's own name, email, password, linked
+// logins and account deletion.
+
+func (c *AdminController) Account(ctx *gin.Context) {
+	c.renderAccount(ctx, "", "")
+}
+
+func (c *AdminController) UpdateName(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	name := strings.TrimSpace(ctx.PostForm("name"))
+	if name == "" {
+		c.renderAccount(ctx, "Name cannot be empty", "")
+		return
+	}
+
+	updated, err := c.users.UpdateName(ctx.Request.Context(), user.ID, name)
+	if err != nil {
+		c.renderAccount(ctx, "Failed to update name", "")
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditUserUpdateName,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+		Before:     map[string]string{"name": user.Name},
+		After:      map[string]string{"name": updated.Name},
+	})
+
+	ctx.Redirect(http.StatusFound, "/admin/account")
+}
+
+func (c *AdminController) RequestEmailChange(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	newEmail := strings.TrimSpace(ctx.PostForm("email"))
+
+	if err := c.auth.RequestEmailChange(ctx.Request.Context(), user, newEmail, ctx.PostForm("password"), ctx.ClientIP()); err != nil {
+		msg := "Failed to request email change"
+		switch err {
+		case services.ErrInvalidEmail:
+			msg = "Please enter a valid email address"
+		case services.ErrEmailTaken:
+			msg = "That email address is already in use"
+		case services.ErrInvalidCredentials:
+			msg = "Current password is incorrect"
+		case services.ErrTooManyAttempts:
+			msg = "Too many failed attempts. Please try again later."
+		}
+		c.renderAccount(ctx, msg, "")
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditUserRequestEmail,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+		After:      map[string]string{"new_email": newEmail},
+	})
+
+	c.renderAccount(ctx, "", "We sent a confirmation link to "+newEmail+". Your email changes once you open it.")
+}
+
+// ConfirmEmailChange is reached from the emailed link, so it does not require
+// a session; the token alone identifies the account.
+func (c *AdminController) EmailChangePage(ctx *gin.Context) {
+	admin.EmailChangeConfirm(ctx.Query("token")).Render(ctx.Request.Context(), ctx.Writer)
+}
+
+func (c *AdminController) ConfirmEmailChange(ctx *gin.Context) {
+	before := ""
+	if token, err := ctx.Cookie(middleware.SessionCookieName); err == nil {
+		if _, current, err := c.auth.ValidateSession(ctx.Request.Context(), token); err == nil {
+			before = current.Email
+		}
+	}
+
+	user, err := c.auth.ConfirmEmailChange(ctx.Request.Context(), ctx.PostForm("token"))
+	if err != nil {
+		msg := "This confirmation link is invalid or has expired"
+		if err == services.ErrEmailTaken {
+			msg = "That email address is already in use"
+		}
+		ctx.String(http.StatusBadRequest, msg)
+		return
+	}
+
+	entry := services.AuditEntry{
+		ActorID:    user.ID,
+		Action:     models.AuditUserChangeEmail,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+		After:      map[string]string{"email": user.Email},
+	}
+	if before != "" {
+		entry.Before = map[string]string{"email": before}
+	}
+	recordAudit(ctx, c.audit, entry)
+
+	admin.EmailConfirmed(user.Email).Render(ctx.Request.Context(), ctx.Writer)
+}
+
+func (c *AdminController) ChangePassword(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	current := middleware.GetSession(ctx)
+
+	newPassword := ctx.PostForm("new_password")
+	if newPassword != ctx.PostForm("confirm_password") {
+		c.renderAccount(ctx, "New passwords do not match", "")
+		return
+	}
+
+	err := c.auth.ChangePassword(ctx.Request.Context(), user, ctx.PostForm("current_password"), newPassword, ctx.ClientIP())
+	if err != nil {
+		msg := "Failed to change password"
+		if err == services.ErrInvalidCredentials {
+			msg = "Current password is incorrect"
+		} else if err == services.ErrTooManyAttempts {
+			msg = "Too many failed attempts. Please try again later."
+		} else if policyMsg, ok := passwordPolicyMessage(err); ok {
+			msg = policyMsg
+		}
+		c.renderAccount(ctx, msg, "")
+		return
+	}
+
+	// Anyone signed in with the old password is signed out
+	c.auth.RevokeOtherSessions(ctx.Request.Context(), user.ID, current.ID)
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditUserChangePassword,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+	})
+
+	c.renderAccount(ctx, "", "Password changed. Your other sessions have been signed out.")
+}
+
+func (c *AdminController) UnlinkLogin(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	id := getIDParam(ctx, "id")
+
+	if err := c.auth.UnlinkLogin(ctx.Request.Context(), user.ID, id); err != nil {
+		msg := "Failed to remove login"
+		if err == services.ErrLastLogin {
+			msg = "You can't remove your only way to sign in"
+		}
+		c.renderAccount(ctx, msg, "")
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditUserUnlinkLogin,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+		Before:     map[string]int{"login_id": id},
+	})
+
+	ctx.Redirect(http.StatusFound, "/admin/account")
+}
+
+func (c *AdminController) DeleteAccount(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+
+	// Typing the email guards against a stray click; the password (when the
+	// account has one) guards against an unattended session
+	confirmEmail := strings.TrimSpace(ctx.PostForm("confirm_email"))
+	if subtle.ConstantTimeCompare([]byte(confirmEmail), []byte(user.Email)) != 1 {
+		c.renderAccount(ctx, "Type your email address to confirm deletion", "")
+		return
+	}
+	if err := c.auth.VerifyPassword(ctx.Request.Context(), user, ctx.PostForm("password"), ctx.ClientIP()); err != nil {
+		msg := "Failed to check your password"
+		switch err {
+		case services.ErrInvalidCredentials:
+			msg = "Current password is incorrect"
+		case services.ErrTooManyAttempts:
+			msg = "Too many failed attempts. Please try again later."
+		}
+		c.renderAccount(ctx, msg, "")
+		return
+	}
+
+	if err := c.users.DeleteAccount(ctx.Request.Context(), user); err != nil {
+		msg := "Failed to delete account"
+		if err == services.ErrLastAdmin {
+			msg = "You are the only admin. Make someone else an admin before deleting your account."
+		}
+		c.renderAccount(ctx, msg, "")
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditUserDelete,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+		Before:     user,
+	})
+
+	middleware.SetSessionCookie(ctx, "", -1, c.config.SecureCookies)
+	ctx.Redirect(http.StatusFound, "/admin/login")
+}
+
+// passwordPolicyMessage explains why the password policy rejected a password
+func passwordPolicyMessage(err error) (string, bool) {
+	switch err {
+	case services.ErrPasswordTooShort:
+		return fmt.Sprintf("Password must be at least %d characters", services.MinPasswordLength), true
+	case services.ErrPasswordTooLong:
+		return fmt.Sprintf("Password must be at most %d bytes", services.MaxPasswordLength), true
+	case services.ErrPasswordCommon:
+		return "That password is too common. Please choose another.", true
+	case services.ErrPasswordPersonal:
+		return "Password can't be your name or email address", true
+	case services.ErrPasswordBreached:
+		return "That password has appeared in a data breach. Please choose another.", true
+	}
+	return "", false
+}
+
+func (c *AdminController) renderAccount(ctx *gin.Context, errorMsg, notice string) {
+	user := middleware.GetUser(ctx)
+	logins, _ := c.auth.GetUserLogins(ctx.Request.Context(), user.ID)
+
+	admin.Account(user, logins, c.auth.OAuthProviderNames(), errorMsg, notice).Render(ctx.Request.Context(), ctx.Writer)
+}
@@ -1,7 +1,12 @@
 package controllers
 
 import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -9,12 +14,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/ioverpi/personal-site/internal/config"
 	"github.com/ioverpi/personal-site/internal/middleware"
+	"github.com/ioverpi/personal-site/internal/models"
 	"github.com/ioverpi/personal-site/internal/services"
 	"github.com/ioverpi/personal-site/templates/pages/admin"
 )
 
-// Note: CSRF tokens removed - using SameSite=Lax cookies for CSRF protection instead
-
 type AdminController struct {
 	content  *services.AdminService
 	blog     *services.BlogService
@@ -22,6 +26,8 @@ type AdminController struct {
 	quotes   *services.QuotesService
 	auth     *services.AuthService
 	users    *services.UserService
+	tokens   *services.APITokenService
+	audit    *services.AuditService
 	config   *config.Config
 }
 
@@ -32,6 +38,8 @@ func NewAdminController(
 	quotesService *services.QuotesService,
 	authService *services.AuthService,
 	userService *services.UserService,
+	apiTokenService *services.APITokenService,
+	auditService *services.AuditService,
 	cfg *config.Config,
 ) *AdminController {
 	return &AdminController{
@@ -41,6 +49,8 @@ func NewAdminController(
 		quotes:   quotesService,
 		auth:     authService,
 		users:    userService,
+		tokens:   apiTokenService,
+		audit:    auditService,
 		config:   cfg,
 	}
 }
@@ -48,38 +58,101 @@ func NewAdminController(
 // Auth
 
 func (c *AdminController) LoginPage(ctx *gin.Context) {
-	admin.Login("").Render(ctx.Request.Context(), ctx.Writer)
+	c.renderLogin(ctx, "")
 }
 
 func (c *AdminController) Login(ctx *gin.Context) {
 	email := ctx.PostForm("email")
 	password := ctx.PostForm("password")
 
-	user, err := c.auth.Authenticate(email, password)
+	user, err := c.auth.Authenticate(ctx.Request.Context(), email, password, ctx.ClientIP())
+	if err != nil {
+		msg := "Invalid email or password"
+		switch err {
+		case services.ErrTooManyAttempts:
+			msg = "Too many failed attempts. Please try again later."
+		case services.ErrAccountDeactivated:
+			msg = "This account has been deactivated"
+		}
+		c.renderLogin(ctx, msg)
+		return
+	}
+
+	c.startSession(ctx, user, "password")
+}
+
+func (c *AdminController) RequestLoginLink(ctx *gin.Context) {
+	email := strings.TrimSpace(ctx.PostForm("email"))
+
+	if err := c.auth.SendLoginLink(ctx.Request.Context(), email, ctx.ClientIP()); err != nil {
+		msg := "Failed to send sign-in link"
+		if err == services.ErrTooManyAttempts {
+			msg = "Too many failed attempts. Please try again later."
+		}
+		c.renderLogin(ctx, msg)
+		return
+	}
+
+	admin.LoginLinkSent(email).Render(ctx.Request.Context(), ctx.Writer)
+}
+
+func (c *AdminController) LoginLinkPage(ctx *gin.Context) {
+	admin.LoginLinkConfirm(ctx.Query("token")).Render(ctx.Request.Context(), ctx.Writer)
+}
+
+func (c *AdminController) LoginWithLink(ctx *gin.Context) {
+	user, err := c.auth.ConsumeLoginLink(ctx.Request.Context(), ctx.PostForm("token"), ctx.ClientIP())
 	if err != nil {
-		admin.Login("Invalid email or password").Render(ctx.Request.Context(), ctx.Writer)
+		msg := "This sign-in link is invalid or has expired"
+		if err == services.ErrTooManyAttempts {
+			msg = "Too many failed attempts. Please try again later."
+		}
+		c.renderLogin(ctx, msg)
 		return
 	}
 
-	// Create session
+	c.startSession(ctx, user, "magic_link")
+}
+
+// renderLogin shows the login page with any configured OAuth providers
+func (c *AdminController) renderLogin(ctx *gin.Context, errorMsg string) {
+	admin.Login(errorMsg, c.auth.OAuthProviderNames()).Render(ctx.Request.Context(), ctx.Writer)
+}
+
+// startSession signs the user in after a successful login, recording how
+// they authenticated.
+func (c *AdminController) startSession(ctx *gin.Context, user *models.User, method string) {
 	duration := time.Duration(c.config.SessionDurationHours) * time.Hour
-	session, err := c.auth.CreateSession(user.ID, duration)
+	session, err := c.auth.CreateSession(ctx.Request.Context(), user.ID, duration, ctx.Request.UserAgent(), ctx.ClientIP())
 	if err != nil {
-		admin.Login("Failed to create session").Render(ctx.Request.Context(), ctx.Writer)
+		c.renderLogin(ctx, "Failed to create session")
 		return
 	}
 
-	// Set cookie
 	maxAge := c.config.SessionDurationHours * 3600
 	middleware.SetSessionCookie(ctx, session.Token, maxAge, c.config.SecureCookies)
 
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		ActorID:    user.ID,
+		Action:     models.AuditUserLogin,
+		TargetType: models.AuditTargetSession,
+		TargetID:   session.ID,
+		After:      map[string]string{"method": method},
+	})
+
 	ctx.Redirect(http.StatusFound, "/admin")
 }
 
 func (c *AdminController) Logout(ctx *gin.Context) {
+	// Logging out of an impersonation returns to the admin's own session
+	if middleware.GetImpersonation(ctx.Request.Context()) != nil {
+		c.StopImpersonating(ctx)
+		return
+	}
+
 	// Delete session from database
 	if token, err := ctx.Cookie(middleware.SessionCookieName); err == nil {
-		c.auth.DeleteSession(token)
+		c.auth.DeleteSession(ctx.Request.Context(), token)
 	}
 
 	// Clear cookie
@@ -91,21 +164,356 @@ func (c *AdminController) Logout(ctx *gin.Context) {
 
 func (c *AdminController) Dashboard(ctx *gin.Context) {
 	user := middleware.GetUser(ctx)
-	posts, _ := c.blog.GetAllPosts()
-	projects, _ := c.projects.GetAllProjects()
-	quotes, _ := c.quotes.GetAllQuotes()
+	posts, _ := c.blog.GetAllPosts(ctx.Request.Context())
+	projects, _ := c.projects.GetAllProjects(ctx.Request.Context())
+	quotes, _ := c.quotes.GetAllQuotes(ctx.Request.Context())
 
 	admin.Dashboard(user, posts, projects, quotes).Render(ctx.Request.Context(), ctx.Writer)
 }
 
+// Profile
+
+func (c *AdminController) Profile(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	admin.Profile(user, "").Render(ctx.Request.Context(), ctx.Writer)
+}
+
+func (c *AdminController) UpdateProfile(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	input := services.UpdateProfileInput{
+		Slug:        ctx.PostForm("slug"),
+		DisplayName: strings.TrimSpace(ctx.PostForm("display_name")),
+		Bio:         strings.TrimSpace(ctx.PostForm("bio")),
+		AvatarURL:   strings.TrimSpace(ctx.PostForm("avatar_url")),
+	}
+
+	updated, err := c.users.UpdateProfile(ctx.Request.Context(), user.ID, input)
+	if err != nil {
+		msg := "Failed to update profile"
+		if err == services.ErrInvalidAvatarURL {
+			msg = "Avatar must be an https:// URL or a path on this site"
+		}
+		admin.Profile(user, msg).Render(ctx.Request.Context(), ctx.Writer)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditUserUpdateProfile,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+		Before:     user,
+		After:      updated,
+	})
+
+	ctx.Redirect(http.StatusFound, "/admin/profile")
+}
+
+func (c *AdminController) SetMagicLink(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	enabled := ctx.PostForm("enabled") == "on"
+
+	updated, err := c.users.SetMagicLinkEnabled(ctx.Request.Context(), user.ID, enabled)
+	if err != nil {
+		admin.Profile(user, "Failed to update sign-in settings").Render(ctx.Request.Context(), ctx.Writer)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditUserSetMagicLink,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+		Before:     map[string]bool{"magic_link_enabled": user.MagicLinkEnabled},
+		After:      map[string]bool{"magic_link_enabled": updated.MagicLinkEnabled},
+	})
+
+	ctx.Redirect(http.StatusFound, "/admin/profile")
+}
+
+// Sessions
+
+func (c *AdminController) Sessions(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	current := middleware.GetSession(ctx)
+	sessions, _ := c.auth.GetUserSessions(ctx.Request.Context(), user.ID)
+
+	admin.Sessions(user, sessions, current.ID).Render(ctx.Request.Context(), ctx.Writer)
+}
+
+func (c *AdminController) RevokeSession(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	current := middleware.GetSession(ctx)
+	id := getIDParam(ctx, "id")
+
+	if err := c.auth.RevokeSession(ctx.Request.Context(), user.ID, id); err != nil {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditSessionRevoke,
+		TargetType: models.AuditTargetSession,
+		TargetID:   id,
+	})
+
+	// Revoking the current session is the same as logging out
+	if id == current.ID {
+		middleware.SetSessionCookie(ctx, "", -1, c.config.SecureCookies)
+		ctx.Redirect(http.StatusFound, "/admin/login")
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, "/admin/sessions")
+}
+
+func (c *AdminController) RevokeOtherSessions(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	current := middleware.GetSession(ctx)
+	if err := c.auth.RevokeOtherSessions(ctx.Request.Context(), user.ID, current.ID); err == nil {
+		recordAudit(ctx, c.audit, services.AuditEntry{
+			Action:     models.AuditSessionRevokeOthers,
+			TargetType: models.AuditTargetUser,
+			TargetID:   user.ID,
+		})
+	}
+	ctx.Redirect(http.StatusFound, "/admin/sessions")
+}
+
+// API tokens
+
+// apiTokenLifetimes are the expiry choices offered on the token form, in days
+var apiTokenLifetimes = map[string]int{"30": 30, "90": 90, "365": 365}
+
+func (c *AdminController) APITokens(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	tokens, _ := c.tokens.GetUserAPITokens(ctx.Request.Context(), user.ID)
+
+	admin.APITokens(user, tokens, "").Render(ctx.Request.Context(), ctx.Writer)
+}
+
+func (c *AdminController) CreateAPIToken(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+
+	days, ok := apiTokenLifetimes[ctx.PostForm("expires_in_days")]
+	if !ok {
+		days = 90
+	}
+
+	token, err := c.tokens.CreateAPIToken(
+		ctx.Request.Context(),
+		user,
+		ctx.PostForm("name"),
+		ctx.PostFormArray("scopes"),
+		time.Duration(days)*24*time.Hour,
+	)
+	if err != nil {
+		msg := "Failed to create token"
+		switch err {
+		case services.ErrTokenNameEmpty:
+			msg = "Please give the token a name"
+		case services.ErrInvalidScope:
+			msg = "Please choose at least one scope your role allows"
+		}
+		tokens, _ := c.tokens.GetUserAPITokens(ctx.Request.Context(), user.ID)
+		admin.APITokens(user, tokens, msg).Render(ctx.Request.Context(), ctx.Writer)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditAPITokenCreate,
+		TargetType: models.AuditTargetAPIToken,
+		TargetID:   token.ID,
+		After:      token,
+	})
+
+	admin.APITokenCreated(user, token).Render(ctx.Request.Context(), ctx.Writer)
+}
+
+func (c *AdminController) RevokeAPIToken(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	id := getIDParam(ctx, "id")
+	if err := c.tokens.RevokeAPIToken(ctx.Request.Context(), user.ID, id); err == nil {
+		recordAudit(ctx, c.audit, services.AuditEntry{
+			Action:     models.AuditAPITokenRevoke,
+			TargetType: models.AuditTargetAPIToken,
+			TargetID:   id,
+		})
+	}
+	ctx.Redirect(http.StatusFound, "/admin/tokens")
+}
+
 // Users
 
 func (c *AdminController) UsersList(ctx *gin.Context) {
+	c.renderUsers(ctx, "")
+}
+
+func (c *AdminController) renderUsers(ctx *gin.Context, errorMsg string) {
 	user := middleware.GetUser(ctx)
-	users, _ := c.users.GetAllUsers()
-	invites, _ := c.auth.GetPendingInvites()
+	users, _ := c.users.GetAllUsers(ctx.Request.Context())
+	invites, _ := c.auth.GetPendingInvites(ctx.Request.Context())
+
+	admin.UsersList(user, users, invites, errorMsg).Render(ctx.Request.Context(), ctx.Writer)
+}
+
+// managedUser loads the user an admin action targets. Admins change their own
+// account from account settings, not here.
+func (c *AdminController) managedUser(ctx *gin.Context) (*models.User, bool) {
+	target, err := c.users.GetByID(ctx.Request.Context(), getIDParam(ctx, "id"))
+	if err != nil {
+		ctx.Status(http.StatusNotFound)
+		return nil, false
+	}
+	if target.ID == middleware.GetUser(ctx).ID {
+		c.renderUsers(ctx, "You can't change your own account from this page")
+		return nil, false
+	}
+	return target, true
+}
+
+// userManagementError maps a failed admin action to a message for the list
+func userManagementError(err error, fallback string) string {
+	switch err {
+	case services.ErrLastAdmin:
+		return "There must be at least one active admin"
+	case services.ErrInvalidRole:
+		return "Unknown role"
+	case services.ErrInvalidReassign:
+		return "Posts must be reassigned to another active user"
+	}
+	return fallback
+}
+
+func (c *AdminController) ChangeUserRole(ctx *gin.Context) {
+	target, ok := c.managedUser(ctx)
+	if !ok {
+		return
+	}
+
+	updated, err := c.users.ChangeRole(ctx.Request.Context(), target.ID, ctx.PostForm("role"))
+	if err != nil {
+		c.renderUsers(ctx, userManagementError(err, "Failed to change role"))
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditUserChangeRole,
+		TargetType: models.AuditTargetUser,
+		TargetID:   target.ID,
+		Before:     map[string]string{"role": target.Role},
+		After:      map[string]string{"role": updated.Role},
+	})
+
+	ctx.Redirect(http.StatusFound, "/admin/users")
+}
+
+func (c *AdminController) DeactivateUser(ctx *gin.Context) {
+	target, ok := c.managedUser(ctx)
+	if !ok {
+		return
+	}
+
+	if _, err := c.users.Deactivate(ctx.Request.Context(), target.ID); err != nil {
+		c.renderUsers(ctx, userManagementError(err, "Failed to deactivate user"))
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditUserDeactivate,
+		TargetType: models.AuditTargetUser,
+		TargetID:   target.ID,
+	})
+
+	ctx.Redirect(http.StatusFound, "/admin/users")
+}
+
+func (c *AdminController) ReactivateUser(ctx *gin.Context) {
+	target, ok := c.managedUser(ctx)
+	if !ok {
+		return
+	}
+
+	if _, err := c.users.Reactivate(ctx.Request.Context(), target.ID); err != nil {
+		c.renderUsers(ctx, "Failed to reactivate user")
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditUserReactivate,
+		TargetType: models.AuditTargetUser,
+		TargetID:   target.ID,
+	})
 
-	admin.UsersList(user, users, invites).Render(ctx.Request.Context(), ctx.Writer)
+	ctx.Redirect(http.StatusFound, "/admin/users")
+}
+
+func (c *AdminController) ConfirmDeleteUser(ctx *gin.Context) {
+	target, ok := c.managedUser(ctx)
+	if !ok {
+		return
+	}
+	c.renderDeleteUser(ctx, target, "")
+}
+
+func (c *AdminController) DeleteUser(ctx *gin.Context) {
+	target, ok := c.managedUser(ctx)
+	if !ok {
+		return
+	}
+
+	reassignTo := 0
+	if raw := ctx.PostForm("reassign_to"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			c.renderDeleteUser(ctx, target, "Choose who should get their posts")
+			return
+		}
+		reassignTo = id
+	}
+
+	if err := c.users.DeleteUser(ctx.Request.Context(), target.ID, reassignTo); err != nil {
+		c.renderDeleteUser(ctx, target, userManagementError(err, "Failed to delete user"))
+		return
+	}
+
+	after := map[string]int{}
+	if reassignTo != 0 {
+		after["posts_reassigned_to"] = reassignTo
+	}
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditUserDelete,
+		TargetType: models.AuditTargetUser,
+		TargetID:   target.ID,
+		Before:     target,
+		After:      after,
+	})
+
+	ctx.Redirect(http.StatusFound, "/admin/users")
+}
+
+func (c *AdminController) renderDeleteUser(ctx *gin.Context, target *models.User, errorMsg string) {
+	postCount, _ := c.users.CountPostsByAuthor(ctx.Request.Context(), target.ID)
+	users, _ := c.users.GetAllUsers(ctx.Request.Context())
+
+	var others []models.User
+	for _, u := range users {
+		if u.ID != target.ID && !u.IsDeactivated() {
+			others = append(others, u)
+		}
+	}
+
+	admin.DeleteUser(target, others, postCount, errorMsg).Render(ctx.Request.Context(), ctx.Writer)
+}
+
+func (c *AdminController) UnlockUser(ctx *gin.Context) {
+	id := getIDParam(ctx, "id")
+	if err := c.auth.UnlockUser(ctx.Request.Context(), id); err == nil {
+		recordAudit(ctx, c.audit, services.AuditEntry{
+			Action:     models.AuditUserUnlock,
+			TargetType: models.AuditTargetUser,
+			TargetID:   id,
+		})
+	}
+	ctx.Redirect(http.StatusFound, "/admin/users")
 }
 
 func (c *AdminController) NewInvite(ctx *gin.Context) {
@@ -113,25 +521,119 @@ func (c *AdminController) NewInvite(ctx *gin.Context) {
 	admin.InviteForm(user, "").Render(ctx.Request.Context(), ctx.Writer)
 }
 
+// inviteExpiryDays are the expiry choices offered on the invite form
+var inviteExpiryDays = map[string]int{"1": 1, "3": 3, "7": 7, "14": 14, "30": 30}
+
 func (c *AdminController) CreateInvite(ctx *gin.Context) {
 	user := middleware.GetUser(ctx)
-	email := ctx.PostForm("email")
 
-	// Invite valid for 7 days
-	invite, err := c.auth.CreateInvite(email, user.ID, 7*24*time.Hour)
+	days, ok := inviteExpiryDays[ctx.DefaultPostForm("expires_in_days", "7")]
+	if !ok {
+		admin.InviteForm(user, "Choose when the invite expires").Render(ctx.Request.Context(), ctx.Writer)
+		return
+	}
+	maxUses := 1
+	if raw := ctx.PostForm("max_uses"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			admin.InviteForm(user, "Number of uses must be a number").Render(ctx.Request.Context(), ctx.Writer)
+			return
+		}
+		maxUses = n
+	}
+
+	invite, err := c.auth.CreateInvite(ctx.Request.Context(), services.CreateInviteInput{
+		Email:     ctx.PostForm("email"),
+		Role:      ctx.PostForm("role"),
+		MaxUses:   maxUses,
+		Duration:  time.Duration(days) * 24 * time.Hour,
+		InvitedBy: user.ID,
+	})
 	if err != nil {
-		admin.InviteForm(user, "Failed to create invite").Render(ctx.Request.Context(), ctx.Writer)
+		msg := "Failed to create invite"
+		switch err {
+		case services.ErrInvalidEmail:
+			msg = "Please enter a valid email address"
+		case services.ErrInvalidRole:
+			msg = "Unknown role"
+		case services.ErrInvalidInviteUses:
+			msg = fmt.Sprintf("Invites for an email are single use; open codes allow 1 to %d uses", services.MaxInviteUses)
+		}
+		admin.InviteForm(user, msg).Render(ctx.Request.Context(), ctx.Writer)
 		return
 	}
 
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditInviteCreate,
+		TargetType: models.AuditTargetInvite,
+		TargetID:   invite.ID,
+		After:      invite,
+	})
+
+	emailed := false
+	if !invite.IsOpen() {
+		if err := c.auth.SendInvite(ctx.Request.Context(), invite, user); err != nil {
+			middleware.Log(ctx).Error("failed to email invite", "invite_id", invite.ID, "error", err)
+		} else {
+			emailed = true
+		}
+	}
+
 	// Show the invite URL so admin can share it
-	inviteURL := c.config.BaseURL + "/register?token=" + invite.Token
-	admin.InviteSuccess(user, invite, inviteURL).Render(ctx.Request.Context(), ctx.Writer)
+	inviteURL := c.auth.InviteURL(invite.Token)
+	admin.InviteSuccess(user, invite, inviteURL, emailed).Render(ctx.Request.Context(), ctx.Writer)
 }
 
-func (c *AdminController) DeleteInvite(ctx *gin.Context) {
+func (c *AdminController) InviteHistory(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	invites, err := c.auth.GetInviteHistory(ctx.Request.Context(), 200)
+	if err != nil {
+		middleware.Log(ctx).Error("failed to load invite history", "error", err)
+	}
+
+	admin.InviteHistory(user, invites, "").Render(ctx.Request.Context(), ctx.Writer)
+}
+
+func (c *AdminController) ResendInvite(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
 	id := getIDParam(ctx, "id")
-	c.auth.DeleteInvite(id)
+
+	invite, err := c.auth.ResendInvite(ctx.Request.Context(), id, user)
+	if err != nil {
+		msg := "Failed to resend invite"
+		if err == services.ErrInviteNotResendable {
+			msg = "Only pending invites sent to an email address can be resent"
+		}
+		invites, _ := c.auth.GetInviteHistory(ctx.Request.Context(), 200)
+		admin.InviteHistory(user, invites, msg).Render(ctx.Request.Context(), ctx.Writer)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditInviteResend,
+		TargetType: models.AuditTargetInvite,
+		TargetID:   invite.ID,
+		After:      map[string]any{"email": invite.Email, "expires_at": invite.ExpiresAt},
+	})
+
+	ctx.Redirect(http.StatusFound, "/admin/invites")
+}
+
+func (c *AdminController) RevokeInvite(ctx *gin.Context) {
+	id := getIDParam(ctx, "id")
+	if err := c.auth.RevokeInvite(ctx.Request.Context(), id); err == nil {
+		recordAudit(ctx, c.audit, services.AuditEntry{
+			Action:     models.AuditInviteRevoke,
+			TargetType: models.AuditTargetInvite,
+			TargetID:   id,
+		})
+	}
+
+	// Return to whichever list the invite was revoked from
+	if ctx.PostForm("from") == "history" {
+		ctx.Redirect(http.StatusFound, "/admin/invites")
+		return
+	}
 	ctx.Redirect(http.StatusFound, "/admin/users")
 }
 
@@ -139,7 +641,7 @@ func (c *AdminController) DeleteInvite(ctx *gin.Context) {
 
 func (c *AdminController) RegisterPage(ctx *gin.Context) {
 	token := ctx.Query("token")
-	invite, err := c.auth.GetInvite(token)
+	invite, err := c.auth.GetInvite(ctx.Request.Context(), token)
 	if err != nil {
 		ctx.String(http.StatusBadRequest, "Invalid or expired invite")
 		return
@@ -153,36 +655,65 @@ func (c *AdminController) Register(ctx *gin.Context) {
 	name := ctx.PostForm("name")
 	password := ctx.PostForm("password")
 
-	invite, err := c.auth.GetInvite(token)
+	invite, err := c.auth.GetInvite(ctx.Request.Context(), token)
 	if err != nil {
 		ctx.String(http.StatusBadRequest, "Invalid or expired invite")
 		return
 	}
 
-	// Create user
-	user, err := c.users.CreateUser(services.CreateUserInput{
-		Email: invite.Email,
-		Name:  name,
-		Role:  "user",
-	})
-	if err != nil {
-		admin.Register(invite, "Failed to create account").Render(ctx.Request.Context(), ctx.Writer)
+	// Open invite codes aren't tied to an address, so the registrant gives one
+	email := invite.Email
+	if invite.IsOpen() {
+		email = strings.TrimSpace(ctx.PostForm("email"))
+		if err := services.ValidateEmail(email); err != nil {
+			admin.Register(invite, "Please enter a valid email address").Render(ctx.Request.Context(), ctx.Writer)
+			return
+		}
+		if _, err := c.users.GetByEmail(ctx.Request.Context(), email); err == nil {
+			admin.Register(invite, "An account with that email already exists").Render(ctx.Request.Context(), ctx.Writer)
+			return
+		}
+	}
+
+	if err := c.auth.CheckNewPassword(ctx.Request.Context(), password, email, name); err != nil {
+		msg, ok := passwordPolicyMessage(err)
+		if !ok {
+			msg = "Failed to check password"
+		}
+		admin.Register(invite, msg).Render(ctx.Request.Context(), ctx.Writer)
 		return
 	}
 
-	// Create login
-	_, err = c.auth.CreatePasswordLogin(user.ID, invite.Email, password)
+	// Create the account, its login and a use of the invite together. If
+	// another registration took the last use first, nothing is created.
+	user, err := c.auth.Register(ctx.Request.Context(), invite, services.RegisterInput{
+		Email:    email,
+		Name:     name,
+		Password: password,
+	})
 	if err != nil {
-		admin.Register(invite, "Failed to set password").Render(ctx.Request.Context(), ctx.Writer)
+		switch err {
+		case services.ErrInvalidInvite:
+			ctx.String(http.StatusBadRequest, "Invalid or expired invite")
+		case services.ErrEmailTaken:
+			admin.Register(invite, "An account with that email already exists").Render(ctx.Request.Context(), ctx.Writer)
+		default:
+			admin.Register(invite, "Failed to create account").Render(ctx.Request.Context(), ctx.Writer)
+		}
 		return
 	}
 
-	// Mark invite as used
-	c.auth.UseInvite(token)
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		ActorID:    user.ID,
+		Action:     models.AuditUserRegister,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+		After:      user,
+	})
 
 	// Create session and log in
 	duration := time.Duration(c.config.SessionDurationHours) * time.Hour
-	session, _ := c.auth.CreateSession(user.ID, duration)
+	session, _ := c.auth.CreateSession(ctx.Request.Context(), user.ID, duration, ctx.Request.UserAgent(), ctx.ClientIP())
 	maxAge := c.config.SessionDurationHours * 3600
 	middleware.SetSessionCookie(ctx, session.Token, maxAge, c.config.SecureCookies)
 
@@ -196,27 +727,40 @@ func (c *AdminController) NewPost(ctx *gin.Context) {
 }
 
 func (c *AdminController) CreatePost(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
 	input := services.CreatePostInput{
-		Title:   ctx.PostForm("title"),
-		Slug:    ctx.PostForm("slug"),
-		Content: ctx.PostForm("content"),
-		Publish: ctx.PostForm("publish") == "on",
+		Title:    ctx.PostForm("title"),
+		Slug:     ctx.PostForm("slug"),
+		Content:  ctx.PostForm("content"),
+		Publish:  ctx.PostForm("publish") == "on",
+		AuthorID: user.ID,
 	}
+	scheduledAt, err := parseScheduledAt(ctx.PostForm("scheduled_at"))
+	if err != nil {
+		ctx.String(http.StatusBadRequest, "Invalid publish time")
+		return
+	}
+	input.ScheduledAt = scheduledAt
 
-	_, err := c.content.CreatePost(input)
+	post, err := c.content.CreatePost(ctx.Request.Context(), input)
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		return
 	}
 
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditPostCreate,
+		TargetType: models.AuditTargetPost,
+		TargetID:   post.ID,
+		After:      post,
+	})
+
 	ctx.Redirect(http.StatusFound, "/admin")
 }
 
 func (c *AdminController) EditPost(ctx *gin.Context) {
-	id := getIDParam(ctx, "id")
-	post, err := c.blog.GetPostByID(id)
-	if err != nil {
-		ctx.Status(http.StatusNotFound)
+	post, ok := c.editablePost(ctx)
+	if !ok {
 		return
 	}
 
@@ -224,28 +768,89 @@ func (c *AdminController) EditPost(ctx *gin.Context) {
 }
 
 func (c *AdminController) UpdatePost(ctx *gin.Context) {
-	id := getIDParam(ctx, "id")
+	post, ok := c.editablePost(ctx)
+	if !ok {
+		return
+	}
+
 	input := services.UpdatePostInput{
 		Title:   ctx.PostForm("title"),
 		Slug:    ctx.PostForm("slug"),
 		Content: ctx.PostForm("content"),
 		Publish: ctx.PostForm("publish") == "on",
 	}
+	scheduledAt, err := parseScheduledAt(ctx.PostForm("scheduled_at"))
+	if err != nil {
+		ctx.String(http.StatusBadRequest, "Invalid publish time")
+		return
+	}
+	input.ScheduledAt = scheduledAt
 
-	if _, err := c.content.UpdatePost(id, input); err != nil {
+	updated, err := c.content.UpdatePost(ctx.Request.Context(), post.ID, input)
+	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		return
 	}
 
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditPostUpdate,
+		TargetType: models.AuditTargetPost,
+		TargetID:   post.ID,
+		Before:     post,
+		After:      updated,
+	})
+
 	ctx.Redirect(http.StatusFound, "/admin")
 }
 
 func (c *AdminController) DeletePost(ctx *gin.Context) {
-	id := getIDParam(ctx, "id")
-	c.content.DeletePost(id)
+	post, ok := c.editablePost(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.content.DeletePost(ctx.Request.Context(), post.ID); err == nil {
+		recordAudit(ctx, c.audit, services.AuditEntry{
+			Action:     models.AuditPostDelete,
+			TargetType: models.AuditTargetPost,
+			TargetID:   post.ID,
+			Before:     post,
+		})
+	}
 	ctx.Redirect(http.StatusFound, "/admin")
 }
 
+// editablePost loads the post named by the :id param and checks that the
+// current user may modify it. On failure the response status is already set.
+func (c *AdminController) editablePost(ctx *gin.Context) (*models.Post, bool) {
+	id := getIDParam(ctx, "id")
+	post, err := c.blog.GetPostByID(ctx.Request.Context(), id)
+	if err != nil {
+		ctx.Status(http.StatusNotFound)
+		return nil, false
+	}
+
+	if !middleware.GetUser(ctx).CanEditPost(post) {
+		ctx.Status(http.StatusForbidden)
+		return nil, false
+	}
+
+	return post, true
+}
+
+// parseScheduledAt reads the editor's datetime-local value, which is in the
+// server's time zone. An empty value means the post isn't scheduled.
+func parseScheduledAt(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.ParseInLocation(models.DateTimeLocalFormat, value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
 // Projects
 
 func (c *AdminController) NewProject(ctx *gin.Context) {
@@ -265,18 +870,25 @@ func (c *AdminController) CreateProject(ctx *gin.Context) {
 		DisplayOrder: displayOrder,
 	}
 
-	_, err := c.content.CreateProject(input)
+	project, err := c.content.CreateProject(ctx.Request.Context(), input)
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		return
 	}
 
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditProjectCreate,
+		TargetType: models.AuditTargetProject,
+		TargetID:   project.ID,
+		After:      project,
+	})
+
 	ctx.Redirect(http.StatusFound, "/admin")
 }
 
 func (c *AdminController) EditProject(ctx *gin.Context) {
 	id := getIDParam(ctx, "id")
-	project, err := c.projects.GetProjectByID(id)
+	project, err := c.projects.GetProjectByID(ctx.Request.Context(), id)
 	if err != nil {
 		ctx.Status(http.StatusNotFound)
 		return
@@ -287,6 +899,12 @@ func (c *AdminController) EditProject(ctx *gin.Context) {
 
 func (c *AdminController) UpdateProject(ctx *gin.Context) {
 	id := getIDParam(ctx, "id")
+	project, err := c.projects.GetProjectByID(ctx.Request.Context(), id)
+	if err != nil {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
 	displayOrder, _ := strconv.Atoi(ctx.PostForm("display_order"))
 	tags := parseTags(ctx.PostForm("tags"))
 
@@ -299,17 +917,39 @@ func (c *AdminController) UpdateProject(ctx *gin.Context) {
 		DisplayOrder: displayOrder,
 	}
 
-	if _, err := c.content.UpdateProject(id, input); err != nil {
+	updated, err := c.content.UpdateProject(ctx.Request.Context(), id, input)
+	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		return
 	}
 
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditProjectUpdate,
+		TargetType: models.AuditTargetProject,
+		TargetID:   id,
+		Before:     project,
+		After:      updated,
+	})
+
 	ctx.Redirect(http.StatusFound, "/admin")
 }
 
 func (c *AdminController) DeleteProject(ctx *gin.Context) {
 	id := getIDParam(ctx, "id")
-	c.content.DeleteProject(id)
+	project, err := c.projects.GetProjectByID(ctx.Request.Context(), id)
+	if err != nil {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
+	if err := c.content.DeleteProject(ctx.Request.Context(), id); err == nil {
+		recordAudit(ctx, c.audit, services.AuditEntry{
+			Action:     models.AuditProjectDelete,
+			TargetType: models.AuditTargetProject,
+			TargetID:   id,
+			Before:     project,
+		})
+	}
 	ctx.Redirect(http.StatusFound, "/admin")
 }
 
@@ -326,18 +966,25 @@ func (c *AdminController) CreateQuote(ctx *gin.Context) {
 		IsOwn:   ctx.PostForm("is_own") == "on",
 	}
 
-	_, err := c.content.CreateQuote(input)
+	quote, err := c.content.CreateQuote(ctx.Request.Context(), input)
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		return
 	}
 
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditQuoteCreate,
+		TargetType: models.AuditTargetQuote,
+		TargetID:   quote.ID,
+		After:      quote,
+	})
+
 	ctx.Redirect(http.StatusFound, "/admin")
 }
 
 func (c *AdminController) EditQuote(ctx *gin.Context) {
 	id := getIDParam(ctx, "id")
-	quote, err := c.quotes.GetQuoteByID(id)
+	quote, err := c.quotes.GetQuoteByID(ctx.Request.Context(), id)
 	if err != nil {
 		ctx.Status(http.StatusNotFound)
 		return
@@ -348,28 +995,208 @@ func (c *AdminController) EditQuote(ctx *gin.Context) {
 
 func (c *AdminController) UpdateQuote(ctx *gin.Context) {
 	id := getIDParam(ctx, "id")
+	quote, err := c.quotes.GetQuoteByID(ctx.Request.Context(), id)
+	if err != nil {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
 	input := services.UpdateQuoteInput{
 		Content: ctx.PostForm("content"),
 		Author:  ctx.PostForm("author"),
 		IsOwn:   ctx.PostForm("is_own") == "on",
 	}
 
-	if _, err := c.content.UpdateQuote(id, input); err != nil {
+	updated, err := c.content.UpdateQuote(ctx.Request.Context(), id, input)
+	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		return
 	}
 
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditQuoteUpdate,
+		TargetType: models.AuditTargetQuote,
+		TargetID:   id,
+		Before:     quote,
+		After:      updated,
+	})
+
 	ctx.Redirect(http.StatusFound, "/admin")
 }
 
 func (c *AdminController) DeleteQuote(ctx *gin.Context) {
 	id := getIDParam(ctx, "id")
-	c.content.DeleteQuote(id)
+	quote, err := c.quotes.GetQuoteByID(ctx.Request.Context(), id)
+	if err != nil {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
+	if err := c.content.DeleteQuote(ctx.Request.Context(), id); err == nil {
+		recordAudit(ctx, c.audit, services.AuditEntry{
+			Action:     models.AuditQuoteDelete,
+			TargetType: models.AuditTargetQuote,
+			TargetID:   id,
+			Before:     quote,
+		})
+	}
 	ctx.Redirect(http.StatusFound, "/admin")
 }
 
+// Audit log
+
+// auditPageLimit caps the events shown in the viewer; the CSV export is not capped
+const auditPageLimit = 200
+
+func (c *AdminController) AuditLog(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	filter, query := auditFilterFromQuery(ctx)
+	filter.Limit = auditPageLimit
+
+	events, err := c.audit.GetEvents(ctx.Request.Context(), filter)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		return
+	}
+	users, _ := c.users.GetAllUsers(ctx.Request.Context())
+
+	admin.AuditLog(user, events, users, query, auditPageLimit).Render(ctx.Request.Context(), ctx.Writer)
+}
+
+func (c *AdminController) ExportAuditLog(ctx *gin.Context) {
+	filter, _ := auditFilterFromQuery(ctx)
+
+	// Rows are written as they are read. The headers wait for the first one,
+	// so a query that fails straight away can still return an error status.
+	w := csv.NewWriter(ctx.Writer)
+	started := false
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+		filename := "audit-" + time.Now().Format("20060102-150405") + ".csv"
+		ctx.Header("Content-Type", "text/csv; charset=utf-8")
+		ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.Write([]string{
+			"id", "created_at", "actor_id", "actor_email", "impersonator_email", "action",
+			"target_type", "target_id", "before", "after", "request_id", "ip_address",
+		})
+	}
+
+	err := c.audit.ExportEvents(ctx.Request.Context(), filter, func(event *models.AuditEvent) error {
+		start()
+		return w.Write([]string{
+			strconv.Itoa(event.ID),
+			event.CreatedAt.UTC().Format(time.RFC3339),
+			optionalInt(event.ActorID),
+			csvSafe(event.ActorEmail),
+			csvSafe(optionalString(event.ImpersonatorEmail)),
+			event.Action,
+			event.TargetType,
+			optionalInt(event.TargetID),
+			csvSafe(string(event.Before)),
+			csvSafe(string(event.After)),
+			csvSafe(event.RequestID),
+			event.IPAddress,
+		})
+	})
+	if err != nil && !started {
+		ctx.Status(http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		// The response is already under way, so the file is cut short
+		middleware.Log(ctx).Error("audit export failed part way", "error", err)
+	}
+	start()
+	w.Flush()
+}
+
+// auditFilterFromQuery reads the viewer's filter form. Invalid values are
+// dropped, and the returned query holds only the ones that were applied.
+func auditFilterFromQuery(ctx *gin.Context) (services.AuditFilter, url.Values) {
+	var filter services.AuditFilter
+	query := url.Values{}
+
+	if id, err := strconv.Atoi(ctx.Query("actor")); err == nil && id > 0 {
+		filter.ActorID = id
+		query.Set("actor", ctx.Query("actor"))
+	}
+	if action := ctx.Query("action"); slices.Contains(models.AuditActions, action) {
+		filter.Action = action
+		query.Set("action", action)
+	}
+	if targetType := ctx.Query("target_type"); slices.Contains(models.AuditTargetTypes, targetType) {
+		filter.TargetType = targetType
+		query.Set("target_type", targetType)
+	}
+	if id, err := strconv.Atoi(ctx.Query("target_id")); err == nil && id > 0 {
+		filter.TargetID = id
+		query.Set("target_id", ctx.Query("target_id"))
+	}
+	if from, err := time.Parse("2006-01-02", ctx.Query("from")); err == nil {
+		filter.Since = from
+		query.Set("from", ctx.Query("from"))
+	}
+	if to, err := time.Parse("2006-01-02", ctx.Query("to")); err == nil {
+		filter.Until = to.AddDate(0, 0, 1) // Inclusive of the whole day
+		query.Set("to", ctx.Query("to"))
+	}
+
+	return filter, query
+}
+
 // Helpers
 
+// recordAudit stores an audit event for the current request, filling in the
+// actor (unless set), request ID and client IP. Failures are logged rather
+// than returned so auditing never blocks the action itself.
+func recordAudit(ctx *gin.Context, audit *services.AuditService, entry services.AuditEntry) {
+	if entry.ActorID == 0 {
+		if user := middleware.GetUser(ctx); user != nil {
+			entry.ActorID = user.ID
+			entry.ActorEmail = user.Email
+		}
+		if impersonation := middleware.GetImpersonation(ctx.Request.Context()); impersonation != nil {
+			entry.ImpersonatorEmail = impersonation.Impersonator.Email
+		}
+	}
+	entry.RequestID = middleware.GetRequestID(ctx)
+	entry.IPAddress = ctx.ClientIP()
+
+	if err := audit.Record(ctx.Request.Context(), entry); err != nil {
+		slog.Error("failed to record audit event",
+			"action", entry.Action,
+			"target_type", entry.TargetType,
+			"target_id", entry.TargetID,
+			"error", err,
+		)
+	}
+}
+
+// csvSafe stops spreadsheet apps from treating a cell as a formula
+func csvSafe(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+func optionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+func optionalString(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
 // getIDParam extracts and validates an integer ID from URL params.
 // Panics on invalid ID (caught by Gin's recovery middleware).
 func getIDParam(ctx *gin.Context, name string) int {
@@ -0,0 +1,654 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ioverpi/personal-site/internal/middleware"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/services"
+)
+
+// APIController serves the JSON API under /api/v1.
+//
+// Every response is an envelope: {"data": ...} on success, with "meta" added
+// for paginated lists, or {"error": {"code", "message", "fields"}} on failure.
+type APIController struct {
+	content  *services.AdminService
+	blog     *services.BlogService
+	projects *services.ProjectsService
+	quotes   *services.QuotesService
+	audit    *services.AuditService
+}
+
+func NewAPIController(
+	contentService *services.AdminService,
+	blogService *services.BlogService,
+	projectsService *services.ProjectsService,
+	quotesService *services.QuotesService,
+	auditService *services.AuditService,
+) *APIController {
+	return &APIController{
+		content:  contentService,
+		blog:     blogService,
+		projects: projectsService,
+		quotes:   quotesService,
+		audit:    auditService,
+	}
+}
+
+// Me describes the authenticated user and the token in use
+func (c *APIController) Me(ctx *gin.Context) {
+	user := middleware.GetUser(ctx)
+	token := middleware.GetAPIToken(ctx)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"id":   user.ID,
+			"name": user.PublicName(),
+			"role": user.Role,
+			"token": gin.H{
+				"name":       token.Name,
+				"scopes":     token.Scopes,
+				"expires_at": token.ExpiresAt,
+			},
+		},
+	})
+}
+
+// Posts
+
+type postRequest struct {
+	Title       string     `json:"title"`
+	Slug        string     `json:"slug"`
+	Content     string     `json:"content"`
+	Publish     bool       `json:"publish"`
+	ScheduledAt *time.Time `json:"scheduled_at"`
+}
+
+func (r *postRequest) validate() map[string]string {
+	fields := map[string]string{}
+	r.Title = strings.TrimSpace(r.Title)
+	r.Slug = strings.TrimSpace(r.Slug)
+
+	if r.Title == "" {
+		fields["title"] = "is required"
+	} else if len(r.Title) > 255 {
+		fields["title"] = "must be at most 255 characters"
+	}
+	if r.Slug != "" && !slugPattern.MatchString(r.Slug) {
+		fields["slug"] = "may only contain lowercase letters, digits and single dashes"
+	}
+	if strings.TrimSpace(r.Content) == "" {
+		fields["content"] = "is required"
+	}
+	return fields
+}
+
+func (c *APIController) ListPosts(ctx *gin.Context) {
+	page, perPage, ok := pageParams(ctx)
+	if !ok {
+		return
+	}
+	posts, total, err := c.blog.GetPostsPage(ctx.Request.Context(), page, perPage)
+	if err != nil {
+		apiInternalError(ctx, err)
+		return
+	}
+	respondPage(ctx, posts, page, perPage, total)
+}
+
+func (c *APIController) GetPost(ctx *gin.Context) {
+	post, ok := c.loadPost(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": post})
+}
+
+func (c *APIController) CreatePost(ctx *gin.Context) {
+	var req postRequest
+	if !bindAPIRequest(ctx, &req) {
+		return
+	}
+
+	post, err := c.content.CreatePost(ctx.Request.Context(), services.CreatePostInput{
+		Title:       req.Title,
+		Slug:        req.Slug,
+		Content:     req.Content,
+		Publish:     req.Publish,
+		ScheduledAt: req.ScheduledAt,
+		AuthorID:    middleware.GetUser(ctx).ID,
+	})
+	if err != nil {
+		apiWriteError(ctx, err)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditPostCreate,
+		TargetType: models.AuditTargetPost,
+		TargetID:   post.ID,
+		After:      post,
+	})
+
+	ctx.Header("Location", fmt.Sprintf("/api/v1/posts/%d", post.ID))
+	ctx.JSON(http.StatusCreated, gin.H{"data": post})
+}
+
+func (c *APIController) UpdatePost(ctx *gin.Context) {
+	post, ok := c.loadEditablePost(ctx)
+	if !ok {
+		return
+	}
+
+	var req postRequest
+	if !bindAPIRequest(ctx, &req) {
+		return
+	}
+
+	updated, err := c.content.UpdatePost(ctx.Request.Context(), post.ID, services.UpdatePostInput{
+		Title:       req.Title,
+		Slug:        req.Slug,
+		Content:     req.Content,
+		Publish:     req.Publish,
+		ScheduledAt: req.ScheduledAt,
+	})
+	if err != nil {
+		apiWriteError(ctx, err)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditPostUpdate,
+		TargetType: models.AuditTargetPost,
+		TargetID:   post.ID,
+		Before:     post,
+		After:      updated,
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+func (c *APIController) DeletePost(ctx *gin.Context) {
+	post, ok := c.loadEditablePost(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.content.DeletePost(ctx.Request.Context(), post.ID); err != nil {
+		apiInternalError(ctx, err)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditPostDelete,
+		TargetType: models.AuditTargetPost,
+		TargetID:   post.ID,
+		Before:     post,
+	})
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *APIController) loadPost(ctx *gin.Context) (*models.Post, bool) {
+	id, ok := apiIDParam(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	post, err := c.blog.GetPostByID(ctx.Request.Context(), id)
+	if err != nil {
+		apiLookupError(ctx, err, "post")
+		return nil, false
+	}
+	return post, true
+}
+
+// loadEditablePost is loadPost plus the author ownership check
+func (c *APIController) loadEditablePost(ctx *gin.Context) (*models.Post, bool) {
+	post, ok := c.loadPost(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	if !middleware.GetUser(ctx).CanEditPost(post) {
+		respondAPIError(ctx, http.StatusForbidden, "forbidden", "you can only modify your own posts", nil)
+		return nil, false
+	}
+	return post, true
+}
+
+// Projects
+
+type projectRequest struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Tags         []string `json:"tags"`
+	GithubURL    string   `json:"github_url"`
+	DemoURL      string   `json:"demo_url"`
+	DisplayOrder int      `json:"display_order"`
+}
+
+func (r *projectRequest) validate() map[string]string {
+	fields := map[string]string{}
+	r.Name = strings.TrimSpace(r.Name)
+	r.GithubURL = strings.TrimSpace(r.GithubURL)
+	r.DemoURL = strings.TrimSpace(r.DemoURL)
+
+	if r.Name == "" {
+		fields["name"] = "is required"
+	} else if len(r.Name) > 255 {
+		fields["name"] = "must be at most 255 characters"
+	}
+	if strings.TrimSpace(r.Description) == "" {
+		fields["description"] = "is required"
+	}
+	if r.GithubURL != "" && !isHTTPURL(r.GithubURL) {
+		fields["github_url"] = "must be an http or https URL"
+	}
+	if r.DemoURL != "" && !isHTTPURL(r.DemoURL) {
+		fields["demo_url"] = "must be an http or https URL"
+	}
+
+	tags := make([]string, 0, len(r.Tags))
+	for _, tag := range r.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	r.Tags = tags
+	return fields
+}
+
+func (c *APIController) ListProjects(ctx *gin.Context) {
+	page, perPage, ok := pageParams(ctx)
+	if !ok {
+		return
+	}
+	projects, total, err := c.projects.GetProjectsPage(ctx.Request.Context(), page, perPage)
+	if err != nil {
+		apiInternalError(ctx, err)
+		return
+	}
+	respondPage(ctx, projects, page, perPage, total)
+}
+
+func (c *APIController) GetProject(ctx *gin.Context) {
+	project, ok := c.loadProject(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": project})
+}
+
+func (c *APIController) CreateProject(ctx *gin.Context) {
+	var req projectRequest
+	if !bindAPIRequest(ctx, &req) {
+		return
+	}
+
+	project, err := c.content.CreateProject(ctx.Request.Context(), services.CreateProjectInput{
+		Name:         req.Name,
+		Description:  req.Description,
+		Tags:         req.Tags,
+		GithubURL:    req.GithubURL,
+		DemoURL:      req.DemoURL,
+		DisplayOrder: req.DisplayOrder,
+	})
+	if err != nil {
+		apiWriteError(ctx, err)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditProjectCreate,
+		TargetType: models.AuditTargetProject,
+		TargetID:   project.ID,
+		After:      project,
+	})
+
+	ctx.Header("Location", fmt.Sprintf("/api/v1/projects/%d", project.ID))
+	ctx.JSON(http.StatusCreated, gin.H{"data": project})
+}
+
+func (c *APIController) UpdateProject(ctx *gin.Context) {
+	project, ok := c.loadProject(ctx)
+	if !ok {
+		return
+	}
+
+	var req projectRequest
+	if !bindAPIRequest(ctx, &req) {
+		return
+	}
+
+	updated, err := c.content.UpdateProject(ctx.Request.Context(), project.ID, services.UpdateProjectInput{
+		Name:         req.Name,
+		Description:  req.Description,
+		Tags:         req.Tags,
+		GithubURL:    req.GithubURL,
+		DemoURL:      req.DemoURL,
+		DisplayOrder: req.DisplayOrder,
+	})
+	if err != nil {
+		apiWriteError(ctx, err)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditProjectUpdate,
+		TargetType: models.AuditTargetProject,
+		TargetID:   project.ID,
+		Before:     project,
+		After:      updated,
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+func (c *APIController) DeleteProject(ctx *gin.Context) {
+	project, ok := c.loadProject(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.content.DeleteProject(ctx.Request.Context(), project.ID); err != nil {
+		apiInternalError(ctx, err)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditProjectDelete,
+		TargetType: models.AuditTargetProject,
+		TargetID:   project.ID,
+		Before:     project,
+	})
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *APIController) loadProject(ctx *gin.Context) (*models.Project, bool) {
+	id, ok := apiIDParam(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	project, err := c.projects.GetProjectByID(ctx.Request.Context(), id)
+	if err != nil {
+		apiLookupError(ctx, err, "project")
+		return nil, false
+	}
+	return project, true
+}
+
+// Quotes
+
+type quoteRequest struct {
+	Content string `json:"content"`
+	Author  string `json:"author"`
+	IsOwn   bool   `json:"is_own"`
+}
+
+func (r *quoteRequest) validate() map[string]string {
+	fields := map[string]string{}
+	r.Author = strings.TrimSpace(r.Author)
+
+	if strings.TrimSpace(r.Content) == "" {
+		fields["content"] = "is required"
+	}
+	if r.Author == "" {
+		fields["author"] = "is required"
+	} else if len(r.Author) > 255 {
+		fields["author"] = "must be at most 255 characters"
+	}
+	return fields
+}
+
+func (c *APIController) ListQuotes(ctx *gin.Context) {
+	page, perPage, ok := pageParams(ctx)
+	if !ok {
+		return
+	}
+	quotes, total, err := c.quotes.GetQuotesPage(ctx.Request.Context(), page, perPage)
+	if err != nil {
+		apiInternalError(ctx, err)
+		return
+	}
+	respondPage(ctx, quotes, page, perPage, total)
+}
+
+func (c *APIController) GetQuote(ctx *gin.Context) {
+	quote, ok := c.loadQuote(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": quote})
+}
+
+func (c *APIController) CreateQuote(ctx *gin.Context) {
+	var req quoteRequest
+	if !bindAPIRequest(ctx, &req) {
+		return
+	}
+
+	quote, err := c.content.CreateQuote(ctx.Request.Context(), services.CreateQuoteInput{
+		Content: req.Content,
+		Author:  req.Author,
+		IsOwn:   req.IsOwn,
+	})
+	if err != nil {
+		apiWriteError(ctx, err)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditQuoteCreate,
+		TargetType: models.AuditTargetQuote,
+		TargetID:   quote.ID,
+		After:      quote,
+	})
+
+	ctx.Header("Location", fmt.Sprintf("/api/v1/quotes/%d", quote.ID))
+	ctx.JSON(http.StatusCreated, gin.H{"data": quote})
+}
+
+func (c *APIController) UpdateQuote(ctx *gin.Context) {
+	quote, ok := c.loadQuote(ctx)
+	if !ok {
+		return
+	}
+
+	var req quoteRequest
+	if !bindAPIRequest(ctx, &req) {
+		return
+	}
+
+	updated, err := c.content.UpdateQuote(ctx.Request.Context(), quote.ID, services.UpdateQuoteInput{
+		Content: req.Content,
+		Author:  req.Author,
+		IsOwn:   req.IsOwn,
+	})
+	if err != nil {
+		apiWriteError(ctx, err)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditQuoteUpdate,
+		TargetType: models.AuditTargetQuote,
+		TargetID:   quote.ID,
+		Before:     quote,
+		After:      updated,
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+func (c *APIController) DeleteQuote(ctx *gin.Context) {
+	quote, ok := c.loadQuote(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.content.DeleteQuote(ctx.Request.Context(), quote.ID); err != nil {
+		apiInternalError(ctx, err)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditQuoteDelete,
+		TargetType: models.AuditTargetQuote,
+		TargetID:   quote.ID,
+		Before:     quote,
+	})
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *APIController) loadQuote(ctx *gin.Context) (*models.Quote, bool) {
+	id, ok := apiIDParam(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	quote, err := c.quotes.GetQuoteByID(ctx.Request.Context(), id)
+	if err != nil {
+		apiLookupError(ctx, err, "quote")
+		return nil, false
+	}
+	return quote, true
+}
+
+// Helpers
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type apiError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+type pageMeta struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+// apiValidator is implemented by request bodies. validate normalises the
+// request in place and returns a message per invalid field.
+type apiValidator interface {
+	validate() map[string]string
+}
+
+func respondAPIError(ctx *gin.Context, status int, code, message string, fields map[string]string) {
+	ctx.AbortWithStatusJSON(status, gin.H{
+		"error": apiError{Code: code, Message: message, Fields: fields},
+	})
+}
+
+func apiInternalError(ctx *gin.Context, err error) {
+	ctx.Error(err)
+	respondAPIError(ctx, http.StatusInternalServerError, "internal_error", "something went wrong", nil)
+}
+
+func apiLookupError(ctx *gin.Context, err error, resource string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		respondAPIError(ctx, http.StatusNotFound, "not_found", resource+" not found", nil)
+		return
+	}
+	apiInternalError(ctx, err)
+}
+
+func apiWriteError(ctx *gin.Context, err error) {
+	if errors.Is(err, services.ErrSlugTaken) {
+		respondAPIError(ctx, http.StatusConflict, "conflict", "validation failed",
+			map[string]string{"slug": "is already in use"})
+		return
+	}
+	apiInternalError(ctx, err)
+}
+
+// bindAPIRequest decodes and validates a JSON body, responding with an error
+// envelope and returning false if either step fails.
+func bindAPIRequest(ctx *gin.Context, req apiValidator) bool {
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		respondAPIError(ctx, http.StatusBadRequest, "invalid_json", "request body must be a JSON object", nil)
+		return false
+	}
+	if fields := req.validate(); len(fields) > 0 {
+		respondAPIError(ctx, http.StatusUnprocessableEntity, "validation_failed", "validation failed", fields)
+		return false
+	}
+	return true
+}
+
+func apiIDParam(ctx *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || id <= 0 {
+		respondAPIError(ctx, http.StatusBadRequest, "invalid_id", "id must be a positive integer", nil)
+		return 0, false
+	}
+	return id, true
+}
+
+// pageParams reads the page and per_page query parameters, responding with an
+// error envelope and returning false if either is invalid.
+func pageParams(ctx *gin.Context) (page, perPage int, ok bool) {
+	fields := map[string]string{}
+	page, perPage = 1, defaultPerPage
+
+	if raw := ctx.Query("page"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			fields["page"] = "must be a positive integer"
+		}
+		page = n
+	}
+	if raw := ctx.Query("per_page"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxPerPage {
+			fields["per_page"] = fmt.Sprintf("must be between 1 and %d", maxPerPage)
+		}
+		perPage = n
+	}
+	if len(fields) > 0 {
+		respondAPIError(ctx, http.StatusBadRequest, "invalid_pagination", "invalid pagination parameters", fields)
+		return 0, 0, false
+	}
+	return page, perPage, true
+}
+
+// respondPage writes items as the page'th page of total items
+func respondPage[T any](ctx *gin.Context, items []T, page, perPage, total int) {
+	if items == nil {
+		items = []T{}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": items,
+		"meta": pageMeta{
+			Page:       page,
+			PerPage:    perPage,
+			Total:      total,
+			TotalPages: (total + perPage - 1) / perPage,
+		},
+	})
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ioverpi/personal-site/internal/services"
+	"github.com/ioverpi/personal-site/templates/pages"
+)
+
+type AuthorsController struct {
+	users *services.UserService
+	blog  *services.BlogService
+}
+
+func NewAuthorsController(users *services.UserService, blog *services.BlogService) *AuthorsController {
+	return &AuthorsController{users: users, blog: blog}
+}
+
+func (c *AuthorsController) Show(ctx *gin.Context) {
+	author, err := c.users.GetBySlug(ctx.Request.Context(), ctx.Param("slug"))
+	if err != nil {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
+	posts, err := c.blog.GetPublishedPostsByAuthor(ctx.Request.Context(), author.ID)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		return
+	}
+
+	pages.AuthorPage(author, posts).Render(ctx.Request.Context(), ctx.Writer)
+}
@@ -17,7 +17,7 @@ func NewBlogController(blog *services.BlogService) *BlogController {
 }
 
 func (c *BlogController) List(ctx *gin.Context) {
-	posts, err := c.blog.GetPublishedPosts()
+	posts, err := c.blog.GetPublishedPosts(ctx.Request.Context())
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		return
@@ -29,7 +29,7 @@ func (c *BlogController) List(ctx *gin.Context) {
 func (c *BlogController) Show(ctx *gin.Context) {
 	slug := ctx.Param("slug")
 
-	post, err := c.blog.GetPostBySlug(slug)
+	post, err := c.blog.GetPostBySlug(ctx.Request.Context(), slug)
 	if err != nil {
 		ctx.Status(http.StatusNotFound)
 		return
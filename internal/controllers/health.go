@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ioverpi/personal-site/internal/health"
+)
+
+type HealthController struct {
+	checker *health.Checker
+}
+
+func NewHealthController(checker *health.Checker) *HealthController {
+	return &HealthController{checker: checker}
+}
+
+// Live reports whether the process is working, for restarting it when not
+func (c *HealthController) Live(ctx *gin.Context) {
+	c.respond(ctx, c.checker.Live(ctx.Request.Context()))
+}
+
+// Ready reports whether the server can take traffic, for load balancers
+func (c *HealthController) Ready(ctx *gin.Context) {
+	c.respond(ctx, c.checker.Ready(ctx.Request.Context()))
+}
+
+func (c *HealthController) respond(ctx *gin.Context, report health.Report) {
+	status := http.StatusOK
+	if !report.OK() {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(status, report)
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ioverpi/personal-site/internal/middleware"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/services"
+)
+
+// Impersonation lets an admin view the admin area as another user. The admin's
+// own session is kept in a separate cookie and restored when they stop.
+
+func (c *AdminController) ImpersonateUser(ctx *gin.Context) {
+	target, ok := c.managedUser(ctx)
+	if !ok {
+		return
+	}
+	impersonator := middleware.GetUser(ctx)
+
+	ownToken, err := ctx.Cookie(middleware.SessionCookieName)
+	if err != nil {
+		ctx.Redirect(http.StatusFound, "/admin/login")
+		return
+	}
+
+	session, err := c.auth.StartImpersonation(ctx.Request.Context(), impersonator, target, ctx.Request.UserAgent(), ctx.ClientIP())
+	if err != nil {
+		msg := "Failed to start viewing as user"
+		if err == services.ErrCannotImpersonate {
+			msg = "Admins and deactivated users can't be viewed as"
+		}
+		c.renderUsers(ctx, msg)
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditUserImpersonate,
+		TargetType: models.AuditTargetUser,
+		TargetID:   target.ID,
+		After:      map[string]int{"session_id": session.ID},
+	})
+
+	maxAge := int(services.ImpersonationDuration.Seconds())
+	middleware.SetImpersonatorCookie(ctx, ownToken, maxAge, c.config.SecureCookies)
+	middleware.SetSessionCookie(ctx, session.Token, maxAge, c.config.SecureCookies)
+	ctx.Redirect(http.StatusFound, "/admin")
+}
+
+// StopImpersonating ends the impersonation session and returns the admin to
+// their own session, or to the login page if it has since ended.
+func (c *AdminController) StopImpersonating(ctx *gin.Context) {
+	impersonation := middleware.GetImpersonation(ctx.Request.Context())
+	if impersonation == nil {
+		ctx.Redirect(http.StatusFound, "/admin")
+		return
+	}
+
+	if token, err := ctx.Cookie(middleware.SessionCookieName); err == nil {
+		c.auth.DeleteSession(ctx.Request.Context(), token)
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		ActorID:    impersonation.Impersonator.ID,
+		ActorEmail: impersonation.Impersonator.Email,
+		Action:     models.AuditUserEndImpersonate,
+		TargetType: models.AuditTargetUser,
+		TargetID:   impersonation.User.ID,
+	})
+
+	ownToken, _ := ctx.Cookie(middleware.ImpersonatorCookieName)
+	middleware.SetImpersonatorCookie(ctx, "", -1, c.config.SecureCookies)
+
+	session, user, err := c.auth.ValidateSession(ctx.Request.Context(), ownToken)
+	if err != nil || session.IsImpersonation() || user.ID != impersonation.Impersonator.ID {
+		middleware.SetSessionCookie(ctx, "", -1, c.config.SecureCookies)
+		ctx.Redirect(http.StatusFound, "/admin/login")
+		return
+	}
+
+	maxAge := int(time.Until(session.ExpiresAt).Seconds())
+	middleware.SetSessionCookie(ctx, ownToken, maxAge, c.config.SecureCookies)
+	ctx.Redirect(http.StatusFound, "/admin/users")
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ioverpi/personal-site/internal/middleware"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/services"
+)
+
+// OAuth sign-in and account linking share one callback per provider. The
+// state cookie records which flow started it.
+
+const (
+	oauthStateCookie  = "oauth_state"
+	oauthPurposeLogin = "login"
+	oauthPurposeLink  = "link"
+)
+
+// OAuthLogin starts signing in with a linked provider account
+func (c *AdminController) OAuthLogin(ctx *gin.Context) {
+	c.startOAuth(ctx, oauthPurposeLogin)
+}
+
+// ConnectLogin starts linking a provider account to the signed-in user
+func (c *AdminController) ConnectLogin(ctx *gin.Context) {
+	c.startOAuth(ctx, oauthPurposeLink)
+}
+
+func (c *AdminController) OAuthCallback(ctx *gin.Context) {
+	name := ctx.Param("provider")
+	provider, ok := c.auth.OAuthProvider(name)
+	if !ok {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
+	cookie, _ := ctx.Cookie(oauthStateCookie)
+	ctx.SetCookie(oauthStateCookie, "", -1, "/", "", c.config.SecureCookies, true)
+
+	purpose, state, _ := strings.Cut(cookie, ":")
+	if state == "" || ctx.Query("error") != "" ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(ctx.Query("state"))) != 1 {
+		c.renderLogin(ctx, "Sign-in was cancelled or has expired. Please try again.")
+		return
+	}
+
+	identity, err := provider.Identify(ctx.Request.Context(), ctx.Query("code"), c.oauthRedirectURL(name))
+	if err != nil {
+		middleware.Log(ctx).Error("oauth identify failed", "provider", name, "error", err)
+		c.renderLogin(ctx, "Could not verify your "+models.ProviderName(name)+" account")
+		return
+	}
+
+	switch purpose {
+	case oauthPurposeLink:
+		c.linkOAuthLogin(ctx, name, identity.ID)
+	default:
+		user, err := c.auth.AuthenticateOAuth(ctx.Request.Context(), name, identity.ID, ctx.ClientIP())
+		if err != nil {
+			msg := "No account is linked to that " + models.ProviderName(name) + " login"
+			switch err {
+			case services.ErrTooManyAttempts:
+				msg = "Too many failed attempts. Please try again later."
+			case services.ErrAccountDeactivated:
+				msg = "This account has been deactivated"
+			}
+			c.renderLogin(ctx, msg)
+			return
+		}
+		c.startSession(ctx, user, name)
+	}
+}
+
+// linkOAuthLogin finishes the link flow. The callback is outside the admin
+// group, so the session is checked here.
+func (c *AdminController) linkOAuthLogin(ctx *gin.Context, provider, providerID string) {
+	token, err := ctx.Cookie(middleware.SessionCookieName)
+	if err != nil {
+		ctx.Redirect(http.StatusFound, "/admin/login")
+		return
+	}
+	session, user, err := c.auth.ValidateSession(ctx.Request.Context(), token)
+	if err != nil {
+		ctx.Redirect(http.StatusFound, "/admin/login")
+		return
+	}
+	// ConnectLogin is blocked while impersonating; this catches a flow
+	// started before impersonation began
+	if session.IsImpersonation() {
+		ctx.String(http.StatusForbidden, "This action isn't available while viewing as another user.")
+		return
+	}
+	ctx.Set(middleware.UserContextKey, user)
+	ctx.Set(middleware.SessionContextKey, session)
+
+	login, err := c.auth.LinkLogin(ctx.Request.Context(), user.ID, provider, providerID)
+	if err != nil {
+		msg := "Failed to link login"
+		if err == services.ErrLoginAlreadyLinked {
+			msg = "That " + models.ProviderName(provider) + " account is already linked to another user"
+		}
+		c.renderAccount(ctx, msg, "")
+		return
+	}
+
+	recordAudit(ctx, c.audit, services.AuditEntry{
+		Action:     models.AuditUserLinkLogin,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+		After:      map[string]any{"login_id": login.ID, "provider": provider},
+	})
+
+	ctx.Redirect(http.StatusFound, "/admin/account")
+}
+
+func (c *AdminController) startOAuth(ctx *gin.Context, purpose string) {
+	name := ctx.Param("provider")
+	provider, ok := c.auth.OAuthProvider(name)
+	if !ok {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
+	state, err := services.GenerateToken()
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		return
+	}
+
+	// Lax is required: the provider redirects back with a top-level GET
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oauthStateCookie, purpose+":"+state, 600, "/", "", c.config.SecureCookies, true)
+	ctx.Redirect(http.StatusFound, provider.AuthCodeURL(state, c.oauthRedirectURL(name)))
+}
+
+func (c *AdminController) oauthRedirectURL(provider string) string {
+	return c.config.BaseURL + "/auth/" + provider + "/callback"
+}
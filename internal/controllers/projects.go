@@ -17,7 +17,7 @@ func NewProjectsController(projects *services.ProjectsService) *ProjectsControll
 }
 
 func (c *ProjectsController) List(ctx *gin.Context) {
-	projects, err := c.projects.GetAllProjects()
+	projects, err := c.projects.GetAllProjects(ctx.Request.Context())
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		return
@@ -17,7 +17,7 @@ func NewQuotesController(quotes *services.QuotesService) *QuotesController {
 }
 
 func (c *QuotesController) List(ctx *gin.Context) {
-	quotes, err := c.quotes.GetAllQuotes()
+	quotes, err := c.quotes.GetAllQuotes(ctx.Request.Context())
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		return
@@ -27,7 +27,7 @@ func (c *QuotesController) List(ctx *gin.Context) {
 }
 
 func (c *QuotesController) Random(ctx *gin.Context) {
-	quote, err := c.quotes.GetRandomQuote()
+	quote, err := c.quotes.GetRandomQuote(ctx.Request.Context())
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		return
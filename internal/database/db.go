@@ -2,23 +2,60 @@ package database
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
 )
 
+// Database drivers, as registered with database/sql
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// sqliteTimeFormat is how the SQLite driver writes times with _time_format=sqlite
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+func init() {
+	// SQLite has no NOW(). This one returns UTC in the format the driver
+	// writes times in, so queries shared with Postgres compare timestamps
+	// correctly as text.
+	sqlite.MustRegisterScalarFunction("now", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return time.Now().UTC().Format(sqliteTimeFormat), nil
+	})
+}
+
+// Connect opens the database named by databaseURL. A sqlite: URL, such as
+// sqlite:data/site.db or sqlite::memory:, opens a SQLite file; anything else
+// is passed to Postgres.
 func Connect(databaseURL string) (*sql.DB, error) {
-	db, err := sql.Open("postgres", databaseURL)
+	driverName, dsn := Postgres, databaseURL
+	if path, ok := strings.CutPrefix(databaseURL, "sqlite:"); ok {
+		driverName, dsn = SQLite, sqliteDSN(path)
+	}
+
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
-	db.SetConnMaxIdleTime(1 * time.Minute)
+	if driverName == SQLite {
+		// SQLite allows one writer at a time, so queue queries on a single
+		// connection rather than failing with "database is locked". Keeping it
+		// open also keeps an in-memory database alive.
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(25)
+		db.SetMaxIdleConns(5)
+		db.SetConnMaxLifetime(5 * time.Minute)
+		db.SetConnMaxIdleTime(1 * time.Minute)
+	}
 
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
@@ -26,3 +63,33 @@ func Connect(databaseURL string) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// sqliteDSN turns the path from a sqlite: URL into the driver's DSN, keeping
+// any query parameters given. Times are written and read as UTC, foreign keys
+// are enforced, and transactions take the write lock when they begin.
+func sqliteDSN(path string) string {
+	path = strings.TrimPrefix(path, "//")
+	path, query, _ := strings.Cut(path, "?")
+
+	params, _ := url.ParseQuery(query)
+	params.Set("_time_format", "sqlite")
+	params.Set("_timezone", "UTC")
+	params.Set("_txlock", "immediate")
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	if path != ":memory:" {
+		params.Add("_pragma", "journal_mode(WAL)")
+	}
+	return "file:" + path + "?" + params.Encode()
+}
+
+// Driver returns which driver db was opened with
+func Driver(db *sql.DB) string {
+	switch db.Driver().(type) {
+	case *sqlite.Driver:
+		return SQLite
+	case *pq.Driver:
+		return Postgres
+	}
+	return ""
+}
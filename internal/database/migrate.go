@@ -1,116 +1,712 @@
 package database
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
 	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// MigrationsFS is set by main.go to embed migrations from root directory
+// MigrationsFS is set by main.go to embed migrations from root directory. The
+// Postgres migrations are at its top level and SQLite's are in its sqlite
+// directory.
 var MigrationsFS embed.FS
 
-// Migrate runs all pending migrations
-func Migrate(db *sql.DB) error {
-	// Create migrations tracking table if not exists
-	if err := createMigrationsTable(db); err != nil {
-		return fmt.Errorf("failed to create migrations table: %w", err)
-	}
+// Migration files are named NNN_description.sql. The SQL above a line reading
+// "-- +down" applies the migration and the SQL below it reverts it. A line
+// reading "-- +no-transaction" runs the file's statements one at a time
+// outside a transaction, for statements like CREATE INDEX CONCURRENTLY.
+const (
+	downMarker          = "-- +down"
+	noTransactionMarker = "-- +no-transaction"
+)
+
+const (
+	// DefaultLockTimeout is how long a migrator waits for another process
+	// to finish migrating
+	DefaultLockTimeout = time.Minute
+
+	// migrationLockID is the advisory lock held while migrating
+	migrationLockID  = 7401000
+	lockPollInterval = 500 * time.Millisecond
+)
+
+var (
+	ErrPendingMigrations    = errors.New("database has pending migrations")
+	ErrMigrationDrift       = errors.New("applied migrations have changed")
+	ErrMigrationLockTimeout = errors.New("timed out waiting for another process to finish migrating")
+)
 
-	// Get list of migration files
-	files, err := fs.ReadDir(MigrationsFS, ".")
+type Migration struct {
+	Version       int
+	Filename      string
+	Up            string
+	Down          string
+	Checksum      string // SHA-256 of Up, recorded when the migration is applied
+	NoTransaction bool   // Run statement by statement, outside a transaction
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+	Missing   bool // Recorded as applied but the file no longer exists
+	Modified  bool // Up SQL differs from what was applied
+}
+
+func (s MigrationStatus) IsApplied() bool {
+	return s.AppliedAt != nil
+}
+
+// LoadMigrations reads the migration files in fsys, ordered by version
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.ReadDir(fsys, ".")
 	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %w", err)
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
 	}
 
-	// Sort files by name (they're numbered, so alphabetical = chronological)
-	var migrations []string
+	var migrations []Migration
+	seen := map[int]string{}
 	for _, f := range files {
-		if !f.IsDir() && strings.HasSuffix(f.Name(), ".sql") {
-			migrations = append(migrations, f.Name())
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".sql") {
+			continue
+		}
+
+		prefix, _, _ := strings.Cut(f.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: name must start with a version number", f.Name())
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, f.Name())
+		}
+		seen[version] = f.Name()
+
+		content, err := fs.ReadFile(fsys, f.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", f.Name(), err)
 		}
+		up, down := splitMigration(string(content))
+
+		migrations = append(migrations, Migration{
+			Version:       version,
+			Filename:      f.Name(),
+			Up:            up,
+			Down:          down,
+			Checksum:      checksum(up),
+			NoTransaction: hasMarker(string(content), noTransactionMarker),
+		})
 	}
-	sort.Strings(migrations)
 
-	// Get already-run migrations
-	applied, err := getAppliedMigrations(db)
-	if err != nil {
-		return fmt.Errorf("failed to get applied migrations: %w", err)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// checksum covers only the up SQL, so a down section can still be fixed
+// after the migration has been applied
+func checksum(up string) string {
+	sum := sha256.Sum256([]byte(up))
+	return hex.EncodeToString(sum[:])
+}
+
+func hasMarker(content, marker string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == marker {
+			return true
+		}
 	}
+	return false
+}
 
-	// Run pending migrations
-	for _, filename := range migrations {
-		if applied[filename] {
+func splitMigration(content string) (up, down string) {
+	var upLines, downLines []string
+	inDown := false
+	for _, line := range strings.Split(content, "\n") {
+		if !inDown && strings.TrimSpace(line) == downMarker {
+			inDown = true
 			continue
 		}
+		if inDown {
+			downLines = append(downLines, line)
+		} else {
+			upLines = append(upLines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(upLines, "\n")), strings.TrimSpace(strings.Join(downLines, "\n"))
+}
+
+// Migrator applies and reverts migrations, recording them by filename in
+// schema_migrations
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []Migration
 
-		log.Printf("Running migration: %s", filename)
+	// DryRun writes the SQL that would run to Out instead of running it
+	DryRun bool
+	Out    io.Writer
+
+	// LockTimeout is how long to wait for another process that is migrating
+	// the same database
+	LockTimeout time.Duration
+}
 
-		content, err := fs.ReadFile(MigrationsFS, filename)
+// NewMigrator returns a migrator for the migrations in fsys, or in its sqlite
+// directory when db is a SQLite database
+func NewMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	driver := Driver(db)
+	if driver == SQLite {
+		sub, err := fs.Sub(fsys, "sqlite")
 		if err != nil {
-			return fmt.Errorf("failed to read migration %s: %w", filename, err)
+			return nil, err
+		}
+		fsys = sub
+	}
+
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, driver: driver, migrations: migrations, LockTimeout: DefaultLockTimeout}, nil
+}
+
+// Migrate runs all pending migrations, waiting up to lockTimeout for any
+// other process that is migrating
+func Migrate(ctx context.Context, db *sql.DB, lockTimeout time.Duration) error {
+	m, err := NewMigrator(db, MigrationsFS)
+	if err != nil {
+		return err
+	}
+	m.LockTimeout = lockTimeout
+	_, err = m.Up(ctx)
+	return err
+}
+
+// CheckMigrations returns ErrPendingMigrations if any migration has not been
+// applied, for servers that leave migrating to cmd/migrate
+func CheckMigrations(ctx context.Context, db *sql.DB) error {
+	m, err := NewMigrator(db, MigrationsFS)
+	if err != nil {
+		return err
+	}
+	return m.CheckPending(ctx)
+}
+
+// CheckDrift returns ErrMigrationDrift, naming the files, if an applied
+// migration has been edited or deleted since it was applied
+func CheckDrift(ctx context.Context, db *sql.DB) error {
+	m, err := NewMigrator(db, MigrationsFS)
+	if err != nil {
+		return err
+	}
+	drift, err := m.Drift(ctx)
+	if err != nil {
+		return err
+	}
+	if len(drift) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(drift))
+	for i, s := range drift {
+		reason := "modified"
+		if s.Missing {
+			reason = "missing"
 		}
+		names[i] = fmt.Sprintf("%s (%s)", s.Filename, reason)
+	}
+	return fmt.Errorf("%w: %s", ErrMigrationDrift, strings.Join(names, ", "))
+}
+
+// Status lists every migration with when it was applied, followed by any
+// applied migrations whose files are missing
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-		if err := runMigration(db, filename, string(content)); err != nil {
-			return fmt.Errorf("failed to run migration %s: %w", filename, err)
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if record, ok := applied[migration.Filename]; ok {
+			status.AppliedAt = &record.at
+			// Migrations applied before checksums were recorded can't be checked
+			status.Modified = record.checksum != "" && record.checksum != migration.Checksum
+			delete(applied, migration.Filename)
 		}
+		statuses = append(statuses, status)
+	}
+
+	var missing []string
+	for filename := range applied {
+		missing = append(missing, filename)
+	}
+	sort.Strings(missing)
+	for _, filename := range missing {
+		record := applied[filename]
+		prefix, _, _ := strings.Cut(filename, "_")
+		version, _ := strconv.Atoi(prefix)
+		statuses = append(statuses, MigrationStatus{
+			Migration: Migration{Version: version, Filename: filename, Checksum: record.checksum},
+			AppliedAt: &record.at,
+			Missing:   true,
+		})
+	}
+	return statuses, nil
+}
 
-		log.Printf("Completed migration: %s", filename)
+// Drift returns the applied migrations whose files have been modified or
+// deleted since they were applied
+func (m *Migrator) Drift(ctx context.Context) ([]MigrationStatus, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	var drift []MigrationStatus
+	for _, s := range statuses {
+		if s.Modified || s.Missing {
+			drift = append(drift, s)
+		}
+	}
+	return drift, nil
 }
 
-func createMigrationsTable(db *sql.DB) error {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS schema_migrations (
-			filename VARCHAR(255) PRIMARY KEY,
-			applied_at TIMESTAMP NOT NULL DEFAULT NOW()
-		)
-	`)
-	return err
+// RecordChecksums stores checksums for applied migrations that predate them,
+// trusting the files as they are now. It returns how many were recorded.
+func (m *Migrator) RecordChecksums(ctx context.Context) (int, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	return m.recordChecksums(ctx)
+}
+
+func (m *Migrator) recordChecksums(ctx context.Context) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	recorded := 0
+	for _, migration := range m.migrations {
+		record, ok := applied[migration.Filename]
+		if !ok || record.checksum != "" {
+			continue
+		}
+		if m.DryRun {
+			fmt.Fprintf(m.Out, "-- record checksum: %s\n", migration.Filename)
+			recorded++
+			continue
+		}
+		// Adds the checksum column on first use
+		if recorded == 0 {
+			if err := m.createMigrationsTable(ctx); err != nil {
+				return 0, err
+			}
+		}
+		_, err := m.db.ExecContext(ctx, `
+			UPDATE schema_migrations SET checksum = $1
+			WHERE filename = $2 AND checksum IS NULL
+		`, migration.Checksum, migration.Filename)
+		if err != nil {
+			return recorded, err
+		}
+		recorded++
+	}
+	return recorded, nil
 }
 
-func getAppliedMigrations(db *sql.DB) (map[string]bool, error) {
-	rows, err := db.Query("SELECT filename FROM schema_migrations")
+// Pending returns the migrations not yet applied, in order
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	applied := make(map[string]bool)
-	for rows.Next() {
-		var filename string
-		if err := rows.Scan(&filename); err != nil {
-			return nil, err
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Filename]; !ok {
+			pending = append(pending, migration)
 		}
-		applied[filename] = true
 	}
-	return applied, rows.Err()
+	return pending, nil
 }
 
-func runMigration(db *sql.DB, filename, content string) error {
-	tx, err := db.Begin()
+// CheckPending returns ErrPendingMigrations if any migration has not been
+// applied
+func (m *Migrator) CheckPending(ctx context.Context) error {
+	pending, err := m.Pending(ctx)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d, starting with %s", ErrPendingMigrations, len(pending), pending[0].Filename)
+	}
+	return nil
+}
+
+// Up applies all pending migrations and returns how many ran. Checksums are
+// recorded for earlier migrations that don't have one yet.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if _, err := m.recordChecksums(ctx); err != nil {
+		return 0, fmt.Errorf("failed to record checksums: %w", err)
+	}
+
+	// Read pending migrations only once holding the lock, so a process that
+	// waited doesn't rerun what the lock holder applied
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	for i, migration := range pending {
+		if err := m.apply(ctx, migration); err != nil {
+			return i, err
+		}
+	}
+	if len(pending) > 0 && !m.DryRun {
+		log.Printf("Applied %d migration(s) in %s", len(pending), time.Since(start).Round(time.Millisecond))
+	}
+	return len(pending), nil
+}
+
+// Down reverts the n most recent migrations and returns how many were reverted
+func (m *Migrator) Down(ctx context.Context, n int) (int, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
 
-	// Run the migration SQL
-	if _, err := tx.Exec(content); err != nil {
+	applied, err := m.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if n > len(applied) {
+		n = len(applied)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := m.revert(ctx, applied[len(applied)-1-i]); err != nil {
+			return i, err
+		}
+	}
+	return n, nil
+}
+
+// To migrates up or down so that version is the latest applied migration.
+// Version 0 reverts every migration.
+func (m *Migrator) To(ctx context.Context, version int) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("no migration with version %d", version)
+	}
+
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	applied, err := m.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	for i := len(applied) - 1; i >= 0; i-- {
+		if applied[i].Version <= version {
+			break
+		}
+		if err := m.revert(ctx, applied[i]); err != nil {
+			return err
+		}
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	for _, migration := range pending {
+		if migration.Version > version {
+			break
+		}
+		if err := m.apply(ctx, migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redo reverts the most recent migration and applies it again
+func (m *Migrator) Redo(ctx context.Context) error {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	applied, err := m.appliedMigrations(ctx)
+	if err != nil {
 		return err
 	}
+	if len(applied) == 0 {
+		return errors.New("no migrations have been applied")
+	}
 
-	// Record that we ran it
-	if _, err := tx.Exec(
-		"INSERT INTO schema_migrations (filename) VALUES ($1)",
-		filename,
-	); err != nil {
+	latest := applied[len(applied)-1]
+	if err := m.revert(ctx, latest); err != nil {
 		return err
 	}
+	return m.apply(ctx, latest)
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	if m.DryRun {
+		fmt.Fprintf(m.Out, "-- up: %s\n%s\n\n", migration.Filename, migration.Up)
+		return nil
+	}
+
+	log.Printf("Running migration: %s", migration.Filename)
+	start := time.Now()
+	err := m.run(ctx, migration, migration.Up,
+		"INSERT INTO schema_migrations (filename, checksum) VALUES ($1, $2)", migration.Filename, migration.Checksum)
+	if err != nil {
+		return fmt.Errorf("failed to run migration %s: %w", migration.Filename, err)
+	}
+	log.Printf("Completed migration: %s (%s)", migration.Filename, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("migration %s has no %q section and can't be reverted", migration.Filename, downMarker)
+	}
+	if m.DryRun {
+		fmt.Fprintf(m.Out, "-- down: %s\n%s\n\n", migration.Filename, migration.Down)
+		return nil
+	}
+
+	log.Printf("Reverting migration: %s", migration.Filename)
+	start := time.Now()
+	err := m.run(ctx, migration, migration.Down, "DELETE FROM schema_migrations WHERE filename = $1", migration.Filename)
+	if err != nil {
+		return fmt.Errorf("failed to revert migration %s: %w", migration.Filename, err)
+	}
+	log.Printf("Reverted migration: %s (%s)", migration.Filename, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// run executes migration SQL followed by the schema_migrations bookkeeping,
+// in one transaction unless the migration opts out
+func (m *Migrator) run(ctx context.Context, migration Migration, content, record string, args ...any) error {
+	if err := m.createMigrationsTable(ctx); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	if !migration.NoTransaction {
+		return m.inTx(ctx, content, record, args...)
+	}
+
+	// Each statement is sent on its own: several statements in one query
+	// would run in an implicit transaction. If one fails, the earlier ones
+	// stay applied, so these migrations should be safe to rerun.
+	for _, statement := range SplitStatements(content) {
+		if _, err := m.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	_, err := m.db.ExecContext(ctx, record, args...)
+	return err
+}
 
+// inTx runs the migration SQL and the schema_migrations bookkeeping in one
+// transaction
+func (m *Migrator) inTx(ctx context.Context, content, record string, args ...any) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, content); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
 	return tx.Commit()
 }
+
+// lock takes the migration advisory lock, waiting up to LockTimeout for
+// another process to release it, so replicas starting together take turns
+// rather than racing to apply the same migration. Dry runs don't lock, and
+// nor does SQLite, whose database belongs to a single server.
+func (m *Migrator) lock(ctx context.Context) (unlock func(), err error) {
+	if m.DryRun || m.driver == SQLite {
+		return func() {}, nil
+	}
+
+	// Advisory locks belong to the session, so hold one connection for the
+	// lock's lifetime
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(m.LockTimeout)
+	waited := false
+	for {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, migrationLockID).Scan(&locked); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to take migration lock: %w", err)
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			conn.Close()
+			return nil, ErrMigrationLockTimeout
+		}
+		if !waited {
+			log.Printf("Waiting for another process to finish migrating")
+			waited = true
+		}
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	// Release the lock even if ctx has been cancelled since
+	return func() {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+		conn.Close()
+	}, nil
+}
+
+// appliedMigrations returns the applied migrations that have files, in order
+func (m *Migrator) appliedMigrations(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Filename]; ok {
+			migrations = append(migrations, migration)
+		}
+	}
+	return migrations, nil
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) createMigrationsTable(ctx context.Context) error {
+	if m.driver == SQLite {
+		_, err := m.db.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				filename VARCHAR(255) PRIMARY KEY,
+				applied_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+				checksum VARCHAR(64)
+			)
+		`)
+		return err
+	}
+
+	_, err := m.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			filename VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+		ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum VARCHAR(64);
+	`)
+	return err
+}
+
+// appliedRecord is a schema_migrations row. checksum is empty for migrations
+// applied before checksums were recorded.
+type appliedRecord struct {
+	at       time.Time
+	checksum string
+}
+
+// applied returns the recorded migrations by filename. A database that has
+// never been migrated, or not since checksums were added, isn't modified so
+// dry runs stay read-only.
+func (m *Migrator) applied(ctx context.Context) (map[string]appliedRecord, error) {
+	var tableExists, checksumExists bool
+	var err error
+	if m.driver == SQLite {
+		// SQLite's table has always had the checksum column
+		err = m.db.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')
+		`).Scan(&tableExists)
+		checksumExists = tableExists
+	} else {
+		err = m.db.QueryRowContext(ctx, `
+			SELECT to_regclass('schema_migrations') IS NOT NULL,
+				EXISTS (
+					SELECT 1 FROM information_schema.columns
+					WHERE table_name = 'schema_migrations' AND column_name = 'checksum'
+				)
+		`).Scan(&tableExists, &checksumExists)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	applied := make(map[string]appliedRecord)
+	if !tableExists {
+		return applied, nil
+	}
+
+	query := "SELECT filename, applied_at, COALESCE(checksum, '') FROM schema_migrations"
+	if !checksumExists {
+		query = "SELECT filename, applied_at, '' FROM schema_migrations"
+	}
+	rows, err := m.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var filename string
+		var record appliedRecord
+		if err := rows.Scan(&filename, &record.at, &record.checksum); err != nil {
+			return nil, err
+		}
+		applied[filename] = record
+	}
+	return applied, rows.Err()
+}
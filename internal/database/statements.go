@@ -0,0 +1,83 @@
+package database
+
+import "strings"
+
+// SplitStatements splits SQL on the semicolons that end statements, skipping
+// those inside quotes, comments and dollar-quoted bodies. Statements that are
+// only comments are dropped.
+func SplitStatements(content string) []string {
+	var statements []string
+	start := 0
+
+	flush := func(end int) {
+		statement := strings.TrimSpace(content[start:end])
+		if statement != "" && !onlyComments(statement) {
+			statements = append(statements, statement)
+		}
+		start = end + 1
+	}
+
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; {
+		case c == '\'' || c == '"':
+			// Quotes are escaped by doubling, which this treats as two
+			// adjacent quoted strings
+			if end := strings.IndexByte(content[i+1:], c); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(content)
+			}
+		case c == '-' && strings.HasPrefix(content[i:], "--"):
+			if end := strings.IndexByte(content[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(content)
+			}
+		case c == '/' && strings.HasPrefix(content[i:], "/*"):
+			if end := strings.Index(content[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(content)
+			}
+		case c == '$':
+			if tag := dollarTag(content[i:]); tag != "" {
+				if end := strings.Index(content[i+len(tag):], tag); end >= 0 {
+					i += len(tag) + end + len(tag) - 1
+				} else {
+					i = len(content)
+				}
+			}
+		case c == ';':
+			flush(i)
+		}
+	}
+	if start < len(content) {
+		flush(len(content))
+	}
+	return statements
+}
+
+// dollarTag returns the opening $tag$ at the start of s, or "" if s doesn't
+// start with one
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '$' {
+			return s[:i+1]
+		}
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 1 && c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
+
+func onlyComments(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"unicode"
+
+	"github.com/ioverpi/personal-site/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Traced wraps q so each query runs in a span recording its SQL, without
+// the arguments. driverName is Postgres or SQLite.
+func Traced(q Queryer, driverName string) Queryer {
+	system := semconv.DBSystemNamePostgreSQL
+	if driverName == SQLite {
+		system = semconv.DBSystemNameSQLite
+	}
+	return tracedQueryer{q: q, system: system}
+}
+
+// Untraced returns the Queryer that Traced wrapped, or q itself
+func Untraced(q Queryer) Queryer {
+	if t, ok := q.(tracedQueryer); ok {
+		return t.q
+	}
+	return q
+}
+
+type tracedQueryer struct {
+	q      Queryer
+	system attribute.KeyValue
+}
+
+func (t tracedQueryer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	result, err := t.q.ExecContext(ctx, query, args...)
+	tracing.RecordError(span, err)
+	return result, err
+}
+
+// QueryContext's span covers running the query, not reading the rows
+func (t tracedQueryer) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	rows, err := t.q.QueryContext(ctx, query, args...)
+	tracing.RecordError(span, err)
+	return rows, err
+}
+
+func (t tracedQueryer) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	row := t.q.QueryRowContext(ctx, query, args...)
+	tracing.RecordError(span, row.Err())
+	return row
+}
+
+// start names the span after the statement's first keyword, e.g. SELECT
+func (t tracedQueryer) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	query = strings.TrimSpace(query)
+	operation := query
+	if i := strings.IndexFunc(query, unicode.IsSpace); i >= 0 {
+		operation = query[:i]
+	}
+	operation = strings.ToUpper(operation)
+
+	return tracing.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			t.system,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(query),
+		),
+	)
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Queryer runs queries. *sql.DB and *sql.Tx both satisfy it, so code written
+// against it works the same inside a transaction or out.
+type Queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// InTx runs fn in a transaction on q. The transaction is committed if fn
+// returns nil and rolled back if it returns an error or panics.
+//
+// When q is already a transaction, fn joins it and the outermost InTx
+// commits or rolls back, so operations that need a transaction of their own
+// can also be grouped into a larger one. An error inside must then be
+// returned rather than handled: on Postgres, a failed statement aborts the
+// whole transaction.
+func InTx(ctx context.Context, q Queryer, fn func(tx *sql.Tx) error) error {
+	switch q := Untraced(q).(type) {
+	case *sql.Tx:
+		return fn(q)
+	case *sql.DB:
+		tx, err := q.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	return fmt.Errorf("cannot begin a transaction on %T", q)
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SchemaDiff lists the schema objects that differ between the live database
+// and one built from the migration files
+type SchemaDiff struct {
+	Missing    []string // Expected from the migrations but not in the live database
+	Unexpected []string // In the live database but not produced by the migrations
+}
+
+func (d *SchemaDiff) IsEmpty() bool {
+	return len(d.Missing) == 0 && len(d.Unexpected) == 0
+}
+
+// Verify builds a scratch database from the migrations applied to db and
+// compares its schema with db's. For Postgres, the scratch database is created
+// on db's server from databaseURL, so the user needs CREATEDB, and is dropped
+// afterwards. For SQLite it is an in-memory database.
+func Verify(ctx context.Context, db *sql.DB, databaseURL string, fsys fs.FS) (*SchemaDiff, error) {
+	live, err := NewMigrator(db, fsys)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := live.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scratchURL := "sqlite::memory:"
+	if live.driver != SQLite {
+		var name string
+		scratchURL, name, err = scratchDatabaseURL(databaseURL)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := db.ExecContext(ctx, `CREATE DATABASE `+quoteIdent(name)); err != nil {
+			return nil, fmt.Errorf("failed to create scratch database: %w", err)
+		}
+		defer db.ExecContext(context.Background(), `DROP DATABASE IF EXISTS `+quoteIdent(name))
+	}
+
+	scratch, err := Connect(scratchURL)
+	if err != nil {
+		return nil, err
+	}
+	defer scratch.Close()
+
+	m := &Migrator{db: scratch, driver: live.driver, migrations: live.migrations}
+	for _, migration := range applied {
+		if err := m.apply(ctx, migration); err != nil {
+			return nil, err
+		}
+	}
+
+	liveSchema, err := Schema(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	expectedSchema, err := Schema(ctx, scratch)
+	if err != nil {
+		return nil, err
+	}
+	return diffSchema(liveSchema, expectedSchema), nil
+}
+
+// Schema describes the public schema's tables, columns, indexes and
+// constraints, one sorted line per object, for comparing databases. For
+// SQLite, each table and index is also described by the SQL that created it.
+// Column lines have the same form for both drivers.
+func Schema(ctx context.Context, db *sql.DB) ([]string, error) {
+	queries := []string{
+		`SELECT 'column ' || c.relname || '.' || a.attname || ' ' || format_type(a.atttypid, a.atttypmod)
+			|| CASE WHEN a.attnotnull THEN ' not null' ELSE '' END
+			|| COALESCE(' default ' || pg_get_expr(d.adbin, d.adrelid), '')
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE n.nspname = 'public' AND c.relkind = 'r' AND a.attnum > 0 AND NOT a.attisdropped`,
+
+		`SELECT 'index ' || indexname || ': ' || indexdef
+		FROM pg_indexes
+		WHERE schemaname = 'public'`,
+
+		`SELECT 'constraint ' || c.relname || '.' || con.conname || ': ' || pg_get_constraintdef(con.oid)
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = 'public'`,
+	}
+	if Driver(db) == SQLite {
+		queries = []string{
+			`SELECT 'column ' || m.name || '.' || p.name || ' ' || lower(p.type)
+				|| CASE WHEN p."notnull" OR p.pk THEN ' not null' ELSE '' END
+				|| COALESCE(' default ' || p.dflt_value, '')
+			FROM sqlite_master m, pragma_table_info(m.name) p
+			WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'`,
+
+			`SELECT type || ' ' || name || ': ' || sql
+			FROM sqlite_master
+			WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'`,
+		}
+	}
+
+	var schema []string
+	for _, query := range queries {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema: %w", err)
+		}
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			schema = append(schema, line)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(schema)
+	return schema, nil
+}
+
+func diffSchema(live, expected []string) *SchemaDiff {
+	inLive := make(map[string]bool, len(live))
+	for _, line := range live {
+		inLive[line] = true
+	}
+	inExpected := make(map[string]bool, len(expected))
+	for _, line := range expected {
+		inExpected[line] = true
+	}
+
+	diff := &SchemaDiff{}
+	for _, line := range expected {
+		if !inLive[line] {
+			diff.Missing = append(diff.Missing, line)
+		}
+	}
+	for _, line := range live {
+		if !inExpected[line] {
+			diff.Unexpected = append(diff.Unexpected, line)
+		}
+	}
+	return diff
+}
+
+// scratchDatabaseURL returns databaseURL pointed at a new, randomly named
+// database
+func scratchDatabaseURL(databaseURL string) (scratchURL, name string, err error) {
+	u, err := url.Parse(databaseURL)
+	if err != nil || u.Scheme == "" {
+		return "", "", errors.New("DATABASE_URL must be a URL to verify migrations")
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", "", err
+	}
+	name = strings.TrimPrefix(u.Path, "/") + "_verify_" + hex.EncodeToString(suffix)
+	u.Path = "/" + name
+	return u.String(), name, nil
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ioverpi/personal-site/migrations"
+)
+
+// migratedSchema migrates a fresh database and returns its schema
+func migratedSchema(t *testing.T, databaseURL string) []string {
+	t.Helper()
+
+	db, err := Connect(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	MigrationsFS = migrations.FS
+	if err := Migrate(context.Background(), db, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := Schema(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// redundantPostgresIndexes are plain indexes the Postgres migrations add on
+// columns that already have a unique constraint. The SQLite schema relies on
+// the constraint's own index instead.
+var redundantPostgresIndexes = []string{
+	"index idx_api_tokens_token_hash",
+	"index idx_invites_token_hash",
+	"index idx_logins_provider",
+	"index idx_posts_slug",
+	"index idx_sessions_token_hash",
+	"index idx_users_email",
+}
+
+// schemaShape keeps what both drivers should agree on: each column and
+// whether it is nullable, and the explicitly named indexes. Types, defaults
+// and the SQLite table definitions are left out, since they are written
+// differently for each.
+func schemaShape(schema []string) []string {
+	var shape []string
+	for _, line := range schema {
+		switch {
+		case strings.HasPrefix(line, "column "):
+			line, _, _ = strings.Cut(line, " default ")
+			name := strings.Fields(line)[1]
+			if strings.HasSuffix(line, " not null") {
+				name += " not null"
+			}
+			shape = append(shape, "column "+name)
+		case strings.HasPrefix(line, "index idx_"):
+			name, _, _ := strings.Cut(line, ":")
+			shape = append(shape, name)
+		}
+	}
+	slices.Sort(shape)
+	return shape
+}
+
+func TestSQLiteSchemaShape(t *testing.T) {
+	shape := schemaShape(migratedSchema(t, "sqlite::memory:"))
+	for _, want := range []string{"column users.id not null", "column users.email not null", "column posts.author_id"} {
+		if !slices.Contains(shape, want) {
+			t.Errorf("SQLite schema has no %q", want)
+		}
+	}
+}
+
+// TestSQLiteSchemaMatchesPostgres checks that the hand-written SQLite schema
+// keeps up with the Postgres migrations. It needs a Postgres server whose
+// user can create databases, given by TEST_POSTGRES_URL.
+func TestSQLiteSchemaMatchesPostgres(t *testing.T) {
+	postgresURL := os.Getenv("TEST_POSTGRES_URL")
+	if postgresURL == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+
+	admin, err := Connect(postgresURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	scratchURL, name, err := scratchDatabaseURL(postgresURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.Exec(`CREATE DATABASE ` + quoteIdent(name)); err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Exec(`DROP DATABASE IF EXISTS ` + quoteIdent(name))
+
+	postgres := schemaShape(migratedSchema(t, scratchURL))
+	postgres = slices.DeleteFunc(postgres, func(line string) bool {
+		return slices.Contains(redundantPostgresIndexes, line)
+	})
+	sqlite := schemaShape(migratedSchema(t, "sqlite::memory:"))
+
+	diff := diffSchema(sqlite, postgres)
+	for _, line := range diff.Missing {
+		t.Errorf("SQLite schema is missing %s", line)
+	}
+	for _, line := range diff.Unexpected {
+		t.Errorf("SQLite schema has %s, which Postgres doesn't", line)
+	}
+}
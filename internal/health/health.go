@@ -0,0 +1,153 @@
+// Package health runs the checks behind the liveness and readiness
+// endpoints.
+//
+// Liveness checks whether the process is working at all, so a failure means
+// it should be restarted. Readiness adds the dependencies needed to serve
+// requests, such as the database, so a failure means traffic should go
+// elsewhere until it passes again. Readiness also fails once the server
+// starts shutting down, so load balancers stop sending it new requests.
+package health
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Check statuses
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// Check returns an error if what it checks is unhealthy
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type Checker struct {
+	timeout  time.Duration
+	live     []namedCheck
+	ready    []namedCheck
+	draining atomic.Bool
+}
+
+// New returns a Checker that fails any check still running after timeout
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// AddLiveness adds a check to liveness. Readiness runs it too.
+func (c *Checker) AddLiveness(name string, check Check) {
+	c.live = append(c.live, namedCheck{name, check})
+}
+
+// AddReadiness adds a check to readiness only
+func (c *Checker) AddReadiness(name string, check Check) {
+	c.ready = append(c.ready, namedCheck{name, check})
+}
+
+// Drain makes readiness fail from now on. It is called when shutdown
+// starts.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Result is one check's outcome. The endpoints are public, so Error is a
+// generic message; the underlying error is logged instead.
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// OK reports whether every check passed
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Live runs the liveness checks
+func (c *Checker) Live(ctx context.Context) Report {
+	return c.run(ctx, c.live)
+}
+
+// Ready runs the liveness and readiness checks, and fails while draining
+func (c *Checker) Ready(ctx context.Context) Report {
+	checks := append([]namedCheck{{"shutdown", c.checkDraining}}, c.live...)
+	return c.run(ctx, append(checks, c.ready...))
+}
+
+func (c *Checker) checkDraining(context.Context) error {
+	if c.draining.Load() {
+		return ErrShuttingDown
+	}
+	return nil
+}
+
+// run runs the checks concurrently, each under the timeout
+func (c *Checker) run(ctx context.Context, checks []namedCheck) Report {
+	results := make([]Result, len(checks))
+	done := make(chan struct{})
+	for i, nc := range checks {
+		go func() {
+			results[i] = c.runOne(ctx, nc)
+			done <- struct{}{}
+		}()
+	}
+	for range checks {
+		<-done
+	}
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	for i, nc := range checks {
+		report.Checks[nc.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+	return report
+}
+
+// runOne runs a check under the timeout. A check that ignores its context
+// is left to finish in the background and reported as timed out.
+func (c *Checker) runOne(ctx context.Context, nc namedCheck) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() { errc <- nc.check(ctx) }()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := Result{
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		slog.Warn("health check failed", "check", nc.name, "error", err)
+		result.Status = StatusFailing
+		result.Error = "check failed"
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Error = "timed out"
+		}
+	}
+	return result
+}
@@ -0,0 +1,23 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadyHidesErrors(t *testing.T) {
+	c := New(time.Second)
+	c.AddReadiness("database", func(context.Context) error {
+		return errors.New("dial tcp 10.0.0.5:5432: connection refused")
+	})
+
+	report := c.Ready(context.Background())
+	if report.OK() {
+		t.Fatal("report is ok, want failing")
+	}
+	if got := report.Checks["database"].Error; got != "check failed" {
+		t.Errorf("public error = %q, want a generic message", got)
+	}
+}
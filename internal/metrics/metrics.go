@@ -0,0 +1,69 @@
+// Package metrics defines the Prometheus metrics the server exposes.
+//
+// Metrics are registered on Registry rather than the Prometheus default, so
+// only what is defined here (plus Go runtime, process and connection pool
+// stats) is served. Handler serves them in the Prometheus text format.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// HTTPRequests and HTTPRequestDuration are labelled by the route
+	// template, e.g. /blog/:slug, so they don't grow a series per URL
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	RateLimitRejections = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "rate_limit_rejections_total",
+		Help: "Requests refused by a rate limiter, by route.",
+	}, []string{"route"})
+
+	// Logins counts sign-in attempts by method (password, link, or the OAuth
+	// provider) and result (success, or why it failed)
+	Logins = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "logins_total",
+		Help: "Sign-in attempts, by method and result.",
+	}, []string{"method", "result"})
+
+	JobDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "job_duration_seconds",
+		Help:    "Time taken by background job runs, by job and status.",
+		Buckets: []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+	}, []string{"job", "status"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// RegisterDB adds the connection pool stats of db, labelled with name
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/services"
+)
+
+const APITokenContextKey = "api_token"
+
+// APITokenAuth authenticates JSON API requests with an
+// "Authorization: Bearer <token>" header and sets the token's owner as the user
+func APITokenAuth(tokens *services.APITokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			abortUnauthorized(c, "missing bearer token")
+			return
+		}
+
+		apiToken, user, err := tokens.Authenticate(c.Request.Context(), strings.TrimSpace(token))
+		if err != nil {
+			if err != services.ErrInvalidAPIToken {
+				Log(c).Error("failed to authenticate API token", "error", err)
+			}
+			abortUnauthorized(c, "invalid or expired token")
+			return
+		}
+
+		// A stale last-used time shouldn't refuse the request
+		if err := tokens.MarkUsed(c.Request.Context(), apiToken.ID); err != nil {
+			Log(c).Error("failed to record API token use", "error", err)
+		}
+
+		c.Set(UserContextKey, user)
+		c.Set(APITokenContextKey, apiToken)
+		c.Next()
+	}
+}
+
+// RequireScope ensures the request's API token was granted the scope and
+// that the owner's current role still allows it
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiToken := GetAPIToken(c)
+		user := GetUser(c)
+		if apiToken == nil || user == nil || !apiToken.HasScope(scope) || !user.CanGrantScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": gin.H{
+					"code":    "forbidden",
+					"message": "token is missing the " + scope + " scope",
+				},
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetAPIToken retrieves the authenticated API token from context
+func GetAPIToken(c *gin.Context) *models.APIToken {
+	if apiToken, exists := c.Get(APITokenContextKey); exists {
+		if t, ok := apiToken.(*models.APIToken); ok {
+			return t
+		}
+	}
+	return nil
+}
+
+func abortUnauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="api"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"error": gin.H{
+			"code":    "unauthorized",
+			"message": message,
+		},
+	})
+}
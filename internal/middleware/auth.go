@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -11,8 +12,21 @@ import (
 const (
 	SessionCookieName = "session"
 	UserContextKey    = "user"
+	SessionContextKey = "session"
+
+	// ImpersonatorCookieName holds the admin's own session token while they
+	// view the site as another user, so they can return to it
+	ImpersonatorCookieName = "impersonator_session"
 )
 
+// Impersonation describes an admin viewing the site as another user
+type Impersonation struct {
+	Impersonator *models.User
+	User         *models.User
+}
+
+type impersonationContextKey struct{}
+
 // AuthMiddleware validates session tokens and sets user in context
 func AuthMiddleware(authService *services.AuthService, secureCookies bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -31,7 +45,7 @@ func AuthMiddleware(authService *services.AuthService, secureCookies bool) gin.H
 		}
 
 		// Validate session and get user
-		user, err := authService.GetUserBySession(token)
+		session, user, err := authService.ValidateSession(c.Request.Context(), token)
 		if err != nil {
 			// Clear invalid cookie
 			clearSessionCookie(c, secureCookies)
@@ -39,8 +53,26 @@ func AuthMiddleware(authService *services.AuthService, secureCookies bool) gin.H
 			return
 		}
 
-		// Store user in context for handlers
+		if session.IsImpersonation() {
+			impersonator, err := authService.GetImpersonator(c.Request.Context(), session)
+			if err != nil {
+				authService.DeleteSession(c.Request.Context(), token)
+				clearSessionCookie(c, secureCookies)
+				redirectToLogin(c)
+				return
+			}
+			impersonation := &Impersonation{Impersonator: impersonator, User: user}
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), impersonationContextKey{}, impersonation))
+		}
+
+		// Record activity (throttled to once per SessionTouchInterval)
+		if err := authService.TouchSession(c.Request.Context(), session); err != nil {
+			Log(c).Warn("failed to update session last seen", "error", err)
+		}
+
+		// Store user and session in context for handlers
 		c.Set(UserContextKey, user)
+		c.Set(SessionContextKey, session)
 		c.Next()
 	}
 }
@@ -57,6 +89,45 @@ func RequireAdmin() gin.HandlerFunc {
 	}
 }
 
+// RequirePermission ensures the user's role grants the given permission
+func RequirePermission(perm models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := GetUser(c)
+		if user == nil || !user.Can(perm) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// BlockWhileImpersonating rejects actions only the account owner should take,
+// such as changing credentials, when an admin is viewing as the user
+func BlockWhileImpersonating() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetImpersonation(c.Request.Context()) != nil {
+			c.String(http.StatusForbidden, "This action isn't available while viewing as another user.")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetImpersonation returns the impersonation in effect for the request, or
+// nil. Templates call it with the templ ctx.
+func GetImpersonation(ctx context.Context) *Impersonation {
+	impersonation, _ := ctx.Value(impersonationContextKey{}).(*Impersonation)
+	return impersonation
+}
+
+// SetImpersonatorCookie stores (or, with maxAge -1, clears) the admin's own
+// session token during impersonation
+func SetImpersonatorCookie(c *gin.Context, token string, maxAge int, secureCookies bool) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ImpersonatorCookieName, token, maxAge, "/", "", secureCookies, true)
+}
+
 // GetUser retrieves the authenticated user from context
 func GetUser(c *gin.Context) *models.User {
 	if user, exists := c.Get(UserContextKey); exists {
@@ -67,6 +138,16 @@ func GetUser(c *gin.Context) *models.User {
 	return nil
 }
 
+// GetSession retrieves the current session from context
+func GetSession(c *gin.Context) *models.Session {
+	if session, exists := c.Get(SessionContextKey); exists {
+		if s, ok := session.(*models.Session); ok {
+			return s
+		}
+	}
+	return nil
+}
+
 // SetSessionCookie sets the session cookie with secure settings
 func SetSessionCookie(c *gin.Context, token string, maxAge int, secureCookies bool) {
 	sameSite := http.SameSiteLaxMode
@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var csrfSecret = []byte("test secret")
+
+func newCSRFRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CSRF(csrfSecret, false))
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, CSRFToken(c.Request.Context()))
+	}
+	r.GET("/form", handler)
+	r.POST("/form", handler)
+	r.POST("/api/v1/posts", handler)
+	return r
+}
+
+// csrfRequest makes a request carrying the given nonce and session cookies,
+// either of which may be empty. A form, if given, is sent as the body.
+func csrfRequest(method, path, nonce, session string, form url.Values) *http.Request {
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, path, nil)
+	}
+	if nonce != "" {
+		req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: nonce})
+	}
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: session})
+	}
+	return req
+}
+
+func TestCSRFIssuesNonceAndToken(t *testing.T) {
+	r := newCSRFRouter()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, csrfRequest(http.MethodGet, "/form", "", "session", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET: got status %d, want 200", w.Code)
+	}
+
+	var nonce string
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == CSRFCookieName {
+			nonce = cookie.Value
+			if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+				t.Errorf("nonce cookie should be HttpOnly and SameSite=Lax: %+v", cookie)
+			}
+		}
+	}
+	if len(nonce) != 64 {
+		t.Fatalf("got nonce cookie %q, want 64 hex characters", nonce)
+	}
+	if got, want := w.Body.String(), csrfToken(csrfSecret, nonce, "session"); got != want {
+		t.Errorf("CSRFToken = %q, want %q", got, want)
+	}
+}
+
+func TestCSRFRejectsInvalidTokens(t *testing.T) {
+	nonce := strings.Repeat("a", 64)
+	otherNonce := strings.Repeat("b", 64)
+
+	tests := []struct {
+		name    string
+		nonce   string
+		session string
+		token   string
+	}{
+		{"missing token", nonce, "session", ""},
+		{"token for another session", nonce, "session", csrfToken(csrfSecret, nonce, "other session")},
+		{"token for a logged out session", nonce, "session", csrfToken(csrfSecret, nonce, "")},
+		{"token for another nonce", nonce, "session", csrfToken(csrfSecret, otherNonce, "session")},
+		{"nonce as the token", nonce, "session", nonce},
+		// A nonce cookie that isn't ours is replaced, so no token minted for
+		// it can match
+		{"malformed nonce", "short", "session", csrfToken(csrfSecret, "short", "session")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newCSRFRouter()
+
+			form := url.Values{"title": {"hello"}}
+			if tt.token != "" {
+				form.Set(CSRFFieldName, tt.token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, csrfRequest(http.MethodPost, "/form", tt.nonce, tt.session, form))
+			if w.Code != http.StatusForbidden {
+				t.Errorf("got status %d, want 403", w.Code)
+			}
+		})
+	}
+}
+
+func TestCSRFCrossOriginPost(t *testing.T) {
+	r := newCSRFRouter()
+
+	// A sibling subdomain plants a nonce it knows and posts a form to the
+	// site. The browser attaches the victim's session cookie, but without the
+	// secret the attacker can only guess at the token.
+	planted := strings.Repeat("c", 64)
+	form := url.Values{CSRFFieldName: {csrfToken([]byte("guess"), planted, "")}}
+	req := csrfRequest(http.MethodPost, "/form", planted, "victim session", form)
+	req.Header.Set("Origin", "https://evil.example.com")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %d, want 403", w.Code)
+	}
+}
+
+func TestCSRFAcceptsValidToken(t *testing.T) {
+	nonce := strings.Repeat("a", 64)
+	token := csrfToken(csrfSecret, nonce, "session")
+
+	t.Run("form field", func(t *testing.T) {
+		r := newCSRFRouter()
+		form := url.Values{CSRFFieldName: {token}}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, csrfRequest(http.MethodPost, "/form", nonce, "session", form))
+		if w.Code != http.StatusOK {
+			t.Errorf("got status %d, want 200", w.Code)
+		}
+	})
+
+	t.Run("header", func(t *testing.T) {
+		r := newCSRFRouter()
+		req := csrfRequest(http.MethodPost, "/form", nonce, "session", nil)
+		req.Header.Set(CSRFHeaderName, token)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("got status %d, want 200", w.Code)
+		}
+	})
+}
+
+func TestCSRFExemptsAPI(t *testing.T) {
+	r := newCSRFRouter()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, csrfRequest(http.MethodPost, "/api/v1/posts", "", "", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d, want 200", w.Code)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == CSRFCookieName {
+			t.Errorf("API request was given a nonce cookie")
+		}
+	}
+}
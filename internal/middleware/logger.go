@@ -27,6 +27,7 @@ func Logger() gin.HandlerFunc {
 			"latency_ms", float64(latency.Nanoseconds()) / 1e6,
 			"ip", c.ClientIP(),
 		}
+		attrs = append(attrs, traceAttrs(c)...)
 
 		if query != "" {
 			attrs = append(attrs, "query", query)
@@ -47,7 +48,8 @@ func Logger() gin.HandlerFunc {
 	}
 }
 
-// Log returns a logger with the request ID included
+// Log returns a logger with the request ID, and the trace and span IDs when
+// the request is traced, included
 func Log(c *gin.Context) *slog.Logger {
-	return slog.Default().With("request_id", GetRequestID(c))
+	return slog.Default().With("request_id", GetRequestID(c)).With(traceAttrs(c)...)
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ioverpi/personal-site/internal/metrics"
 )
 
 // RateLimiter provides simple per-IP rate limiting
@@ -80,6 +81,7 @@ func RateLimitMiddleware(rl *RateLimiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
 		if !rl.Allow(ip) {
+			metrics.RateLimitRejections.WithLabelValues(c.FullPath()).Inc()
 			c.AbortWithStatus(http.StatusTooManyRequests)
 			return
 		}
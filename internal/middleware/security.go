@@ -11,14 +11,14 @@ func SecurityHeaders() gin.HandlerFunc {
 		// - default-src 'self': Only load resources from same origin
 		// - script-src 'self' https://unpkg.com: Allow scripts from self and htmx CDN
 		// - style-src 'self' 'unsafe-inline': Allow styles from self and inline (for theme toggle)
-		// - img-src 'self' data:: Allow images from self and data URIs
+		// - img-src 'self' data: https:: Allow images from self, data URIs and HTTPS (author avatars)
 		// - connect-src 'self': Only allow AJAX/fetch to same origin
 		// - frame-ancestors 'none': Prevent embedding in iframes (clickjacking protection)
 		c.Header("Content-Security-Policy",
 			"default-src 'self'; "+
 				"script-src 'self' https://unpkg.com; "+
 				"style-src 'self' 'unsafe-inline'; "+
-				"img-src 'self' data:; "+
+				"img-src 'self' data: https:; "+
 				"connect-src 'self'; "+
 				"frame-ancestors 'none'")
 
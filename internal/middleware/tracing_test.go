@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ioverpi/personal-site/internal/app"
+	"github.com/ioverpi/personal-site/internal/config"
+	"github.com/ioverpi/personal-site/internal/database"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/services"
+	"github.com/ioverpi/personal-site/internal/tracing"
+	"github.com/ioverpi/personal-site/migrations"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider that records spans in memory until
+// the test ends
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	if _, err := tracing.Setup(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+// captureLogs sends the default logger's JSON output to a buffer until the
+// test ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span named %q", name)
+	return tracetest.SpanStub{}
+}
+
+func TestTracing(t *testing.T) {
+	exporter := recordSpans(t)
+	logs := captureLogs(t)
+
+	database.MigrationsFS = migrations.FS
+	application, err := app.New(context.Background(), &config.Config{DatabaseURL: "sqlite::memory:", AutoMigrate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer application.Close()
+
+	post := &models.Post{Title: "Hello", Slug: "hello", Content: "First post"}
+	if err := application.Repos.Posts.Create(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	exporter.Reset()
+
+	blog := services.NewBlogService(application)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Tracing())
+	r.GET("/posts/:id", func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		if _, err := blog.GetPostByID(c.Request.Context(), id); err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		Log(c).Info("loaded post")
+		c.Status(http.StatusOK)
+	})
+
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID = "00f067aa0ba902b7"
+	)
+	req := httptest.NewRequest(http.MethodGet, "/posts/"+strconv.Itoa(post.ID), nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", w.Code)
+	}
+
+	spans := exporter.GetSpans()
+
+	// The server span continues the caller's trace
+	server := findSpan(t, spans, "GET /posts/:id")
+	if server.SpanKind != trace.SpanKindServer {
+		t.Errorf("server span kind = %v, want server", server.SpanKind)
+	}
+	if got := server.SpanContext.TraceID().String(); got != traceID {
+		t.Errorf("server span trace ID = %s, want %s", got, traceID)
+	}
+	if got := server.Parent.SpanID().String(); got != parentSpanID || !server.Parent.IsRemote() {
+		t.Errorf("server span parent = %s (remote %v), want remote %s", got, server.Parent.IsRemote(), parentSpanID)
+	}
+
+	// The service span is a child of the server span, and the query a child
+	// of the service span
+	service := findSpan(t, spans, "BlogService.GetPostByID")
+	if service.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("service span parent = %s, want the server span %s", service.Parent.SpanID(), server.SpanContext.SpanID())
+	}
+	query := findSpan(t, spans, "SELECT")
+	if query.Parent.SpanID() != service.SpanContext.SpanID() {
+		t.Errorf("query span parent = %s, want the service span %s", query.Parent.SpanID(), service.SpanContext.SpanID())
+	}
+	if query.SpanKind != trace.SpanKindClient {
+		t.Errorf("query span kind = %v, want client", query.SpanKind)
+	}
+	if !slices.Contains(query.Attributes, semconv.DBSystemNameSQLite) {
+		t.Errorf("query span attributes %v, want %v", query.Attributes, semconv.DBSystemNameSQLite)
+	}
+	for _, span := range []tracetest.SpanStub{service, query} {
+		if span.SpanContext.TraceID() != server.SpanContext.TraceID() {
+			t.Errorf("span %q is in trace %s, want %s", span.Name, span.SpanContext.TraceID(), traceID)
+		}
+	}
+
+	// Log adds the request span's IDs
+	type logLine struct {
+		Msg     string `json:"msg"`
+		TraceID string `json:"trace_id"`
+		SpanID  string `json:"span_id"`
+	}
+	var line logLine
+	dec := json.NewDecoder(logs)
+	for line.Msg != "loaded post" {
+		line = logLine{}
+		if err := dec.Decode(&line); err != nil {
+			t.Fatalf("no log line from the handler: %v", err)
+		}
+	}
+	if line.TraceID != traceID || line.SpanID != server.SpanContext.SpanID().String() {
+		t.Errorf("log line has trace_id %q, span_id %q, want %q, %q",
+			line.TraceID, line.SpanID, traceID, server.SpanContext.SpanID())
+	}
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+type APIToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"-"` // Plaintext, only set when the token is created
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (t *APIToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// API token scopes, read or write per resource
+const (
+	ScopePostsRead     = "posts:read"
+	ScopePostsWrite    = "posts:write"
+	ScopeProjectsRead  = "projects:read"
+	ScopeProjectsWrite = "projects:write"
+	ScopeQuotesRead    = "quotes:read"
+	ScopeQuotesWrite   = "quotes:write"
+)
+
+// APIScopes lists every scope a token can be granted
+var APIScopes = []string{
+	ScopePostsRead, ScopePostsWrite,
+	ScopeProjectsRead, ScopeProjectsWrite,
+	ScopeQuotesRead, ScopeQuotesWrite,
+}
+
+// scopePermissions maps write scopes to the role permission they require.
+// Read scopes are available to every role.
+var scopePermissions = map[string]Permission{
+	ScopePostsWrite:    PermCreatePosts,
+	ScopeProjectsWrite: PermManageProjects,
+	ScopeQuotesWrite:   PermManageQuotes,
+}
+
+// CanGrantScope reports whether the user's role allows a token with the scope
+func (u *User) CanGrantScope(scope string) bool {
+	if !slices.Contains(APIScopes, scope) {
+		return false
+	}
+	perm, ok := scopePermissions[scope]
+	return !ok || u.Can(perm)
+}
@@ -0,0 +1,93 @@
+package models
+
+import "time"
+
+// AuditEvent records a single mutating action taken in the admin area or API.
+// Before and After hold JSON snapshots of the target and are nil when there
+// is nothing to show (e.g. no "before" for a create).
+type AuditEvent struct {
+	ID         int
+	ActorID    *int   // Nil if the actor's account has since been deleted
+	ActorEmail string // Kept so the record survives the actor being deleted
+	// ImpersonatorEmail is the admin who acted as the actor, if any
+	ImpersonatorEmail *string
+	Action            string
+	TargetType        string
+	TargetID          *int
+	Before            []byte
+	After             []byte
+	RequestID         string
+	IPAddress         string
+	CreatedAt         time.Time
+}
+
+// Audit target types
+const (
+	AuditTargetPost     = "post"
+	AuditTargetProject  = "project"
+	AuditTargetQuote    = "quote"
+	AuditTargetUser     = "user"
+	AuditTargetInvite   = "invite"
+	AuditTargetSession  = "session"
+	AuditTargetAPIToken = "api_token"
+)
+
+// AuditTargetTypes lists every target type, for filtering
+var AuditTargetTypes = []string{
+	AuditTargetPost, AuditTargetProject, AuditTargetQuote, AuditTargetUser,
+	AuditTargetInvite, AuditTargetSession, AuditTargetAPIToken,
+}
+
+// Audit actions, named "<target>.<verb>"
+const (
+	AuditPostCreate          = "post.create"
+	AuditPostUpdate          = "post.update"
+	AuditPostDelete          = "post.delete"
+	AuditProjectCreate       = "project.create"
+	AuditProjectUpdate       = "project.update"
+	AuditProjectDelete       = "project.delete"
+	AuditQuoteCreate         = "quote.create"
+	AuditQuoteUpdate         = "quote.update"
+	AuditQuoteDelete         = "quote.delete"
+	AuditUserRegister        = "user.register"
+	AuditUserLogin           = "user.login"
+	AuditUserSetMagicLink    = "user.set_magic_link"
+	AuditUserUpdateProfile   = "user.update_profile"
+	AuditUserUnlock          = "user.unlock"
+	AuditUserUpdateName      = "user.update_name"
+	AuditUserRequestEmail    = "user.request_email_change"
+	AuditUserChangeEmail     = "user.change_email"
+	AuditUserChangePassword  = "user.change_password"
+	AuditUserLinkLogin       = "user.link_login"
+	AuditUserUnlinkLogin     = "user.unlink_login"
+	AuditUserDelete          = "user.delete"
+	AuditUserChangeRole      = "user.change_role"
+	AuditUserDeactivate      = "user.deactivate"
+	AuditUserReactivate      = "user.reactivate"
+	AuditUserImpersonate     = "user.impersonate"
+	AuditUserEndImpersonate  = "user.end_impersonation"
+	AuditInviteCreate        = "invite.create"
+	AuditInviteDelete        = "invite.delete" // Before invites were kept as history
+	AuditInviteRevoke        = "invite.revoke"
+	AuditInviteResend        = "invite.resend"
+	AuditSessionRevoke       = "session.revoke"
+	AuditSessionRevokeOthers = "session.revoke_others"
+	AuditAPITokenCreate      = "api_token.create"
+	AuditAPITokenRevoke      = "api_token.revoke"
+)
+
+// AuditActions lists every action, for filtering
+var AuditActions = []string{
+	AuditPostCreate, AuditPostUpdate, AuditPostDelete,
+	AuditProjectCreate, AuditProjectUpdate, AuditProjectDelete,
+	AuditQuoteCreate, AuditQuoteUpdate, AuditQuoteDelete,
+	AuditUserRegister, AuditUserLogin, AuditUserSetMagicLink,
+	AuditUserUpdateProfile, AuditUserUnlock, AuditUserUpdateName,
+	AuditUserRequestEmail, AuditUserChangeEmail, AuditUserChangePassword,
+	AuditUserLinkLogin, AuditUserUnlinkLogin, AuditUserDelete,
+	AuditUserChangeRole, AuditUserDeactivate, AuditUserReactivate,
+	AuditUserImpersonate, AuditUserEndImpersonate,
+	AuditInviteCreate, AuditInviteDelete, AuditInviteRevoke, AuditInviteResend,
+	AuditSessionRevoke, AuditSessionRevokeOthers,
+	AuditAPITokenCreate, AuditAPITokenRevoke,
+}
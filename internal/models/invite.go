@@ -2,14 +2,39 @@ package models
 
 import "time"
 
+// Invite statuses, as shown in the invite history
+const (
+	InviteStatusPending = "pending"
+	InviteStatusUsed    = "used"
+	InviteStatusExpired = "expired"
+	InviteStatusRevoked = "revoked"
+)
+
 type Invite struct {
-	ID        int
-	Email     string
-	Token     string
-	InvitedBy int
-	UsedAt    *time.Time
-	ExpiresAt time.Time
-	CreatedAt time.Time
+	ID            int                `json:"id"`
+	Email         string             `json:"email"` // Empty for an open invite code
+	Role          string             `json:"role"`
+	Token         string             `json:"-"` // Plaintext, only set when created or looked up by token
+	TokenHash     string             `json:"-"`
+	InvitedBy     int                `json:"invited_by"`                // 0 once the sender is deleted
+	InvitedByName string             `json:"invited_by_name,omitempty"` // Filled in by history queries
+	MaxUses       int                `json:"max_uses"`
+	UseCount      int                `json:"use_count"`
+	UsedAt        *time.Time         `json:"used_at"` // Set when the last use is taken
+	RevokedAt     *time.Time         `json:"revoked_at"`
+	LastSentAt    *time.Time         `json:"last_sent_at"`
+	ExpiresAt     time.Time          `json:"expires_at"`
+	CreatedAt     time.Time          `json:"created_at"`
+	Acceptances   []InviteAcceptance `json:"acceptances,omitempty"` // Filled in by history queries
+}
+
+// InviteAcceptance records one registration through an invite
+type InviteAcceptance struct {
+	ID         int       `json:"id"`
+	InviteID   int       `json:"invite_id"`
+	UserID     *int      `json:"user_id"` // Nil once the account is deleted
+	Email      string    `json:"email"`
+	AcceptedAt time.Time `json:"accepted_at"`
 }
 
 func (i *Invite) IsExpired() bool {
@@ -17,5 +42,36 @@ func (i *Invite) IsExpired() bool {
 }
 
 func (i *Invite) IsUsed() bool {
-	return i.UsedAt != nil
+	return i.UsedAt != nil || i.UseCount >= i.MaxUses
+}
+
+func (i *Invite) IsRevoked() bool {
+	return i.RevokedAt != nil
+}
+
+// IsOpen reports whether the invite is a shareable code rather than being
+// addressed to one email
+func (i *Invite) IsOpen() bool {
+	return i.Email == ""
+}
+
+func (i *Invite) RemainingUses() int {
+	if i.IsUsed() {
+		return 0
+	}
+	return i.MaxUses - i.UseCount
+}
+
+// Status summarises the invite for display. Revocation takes precedence,
+// then use, then expiry.
+func (i *Invite) Status() string {
+	switch {
+	case i.IsRevoked():
+		return InviteStatusRevoked
+	case i.IsUsed():
+		return InviteStatusUsed
+	case i.IsExpired():
+		return InviteStatusExpired
+	}
+	return InviteStatusPending
 }
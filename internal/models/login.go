@@ -17,3 +17,16 @@ const (
 	ProviderGoogle   = "google"
 	ProviderGitHub   = "github"
 )
+
+// ProviderName returns a display name for a login provider
+func ProviderName(provider string) string {
+	switch provider {
+	case ProviderPassword:
+		return "Password"
+	case ProviderGoogle:
+		return "Google"
+	case ProviderGitHub:
+		return "GitHub"
+	}
+	return provider
+}
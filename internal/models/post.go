@@ -3,11 +3,23 @@ package models
 import "time"
 
 type Post struct {
-	ID          int
-	Title       string
-	Slug        string
-	Content     string
-	PublishedAt *time.Time
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Slug        string     `json:"slug"`
+	Content     string     `json:"content"`
+	AuthorID    *int       `json:"author_id"`
+	AuthorName  string     `json:"author_name,omitempty"` // Filled in by BlogService queries
+	AuthorSlug  string     `json:"author_slug,omitempty"` // Filled in by BlogService queries
+	PublishedAt *time.Time `json:"published_at"`
+	ScheduledAt *time.Time `json:"scheduled_at"` // When a draft will be published automatically
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// DateTimeLocalFormat is the layout of an HTML datetime-local input value
+const DateTimeLocalFormat = "2006-01-02T15:04"
+
+// IsScheduled reports whether the post is a draft waiting to be published
+func (p *Post) IsScheduled() bool {
+	return p.PublishedAt == nil && p.ScheduledAt != nil
 }
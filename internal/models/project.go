@@ -3,12 +3,12 @@ package models
 import "time"
 
 type Project struct {
-	ID           int
-	Name         string
-	Description  string
-	Tags         []string
-	GithubURL    *string
-	DemoURL      *string
-	DisplayOrder int
-	CreatedAt    time.Time
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Tags         []string  `json:"tags"`
+	GithubURL    *string   `json:"github_url"`
+	DemoURL      *string   `json:"demo_url"`
+	DisplayOrder int       `json:"display_order"`
+	CreatedAt    time.Time `json:"created_at"`
 }
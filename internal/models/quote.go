@@ -3,9 +3,9 @@ package models
 import "time"
 
 type Quote struct {
-	ID        int
-	Content   string
-	Author    string
-	IsOwn     bool
-	CreatedAt time.Time
+	ID        int       `json:"id"`
+	Content   string    `json:"content"`
+	Author    string    `json:"author"`
+	IsOwn     bool      `json:"is_own"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,85 @@
+package models
+
+// Roles, from most to least privileged
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleAuthor = "author"
+	RoleViewer = "viewer"
+)
+
+// Roles lists every assignable role, most privileged first
+var Roles = []string{RoleAdmin, RoleEditor, RoleAuthor, RoleViewer}
+
+// Permission names a single action in the admin area
+type Permission string
+
+const (
+	PermViewDashboard  Permission = "dashboard:view"
+	PermCreatePosts    Permission = "posts:create"
+	PermEditOwnPosts   Permission = "posts:edit_own"
+	PermEditAnyPost    Permission = "posts:edit_any"
+	PermManageProjects Permission = "projects:manage"
+	PermManageQuotes   Permission = "quotes:manage"
+	PermManageInvites  Permission = "invites:manage"
+	PermManageUsers    Permission = "users:manage"
+	PermViewAuditLog   Permission = "audit:view"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermViewDashboard, PermCreatePosts, PermEditOwnPosts, PermEditAnyPost,
+		PermManageProjects, PermManageQuotes, PermManageInvites, PermManageUsers,
+		PermViewAuditLog,
+	},
+	RoleEditor: {
+		PermViewDashboard, PermCreatePosts, PermEditOwnPosts, PermEditAnyPost,
+		PermManageProjects, PermManageQuotes,
+	},
+	RoleAuthor: {
+		PermViewDashboard, PermCreatePosts, PermEditOwnPosts,
+	},
+	RoleViewer: {
+		PermViewDashboard,
+	},
+}
+
+// IsValidRole reports whether role is one of the known roles
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleName returns a display name for a role
+func RoleName(role string) string {
+	switch role {
+	case RoleAdmin:
+		return "Admin"
+	case RoleEditor:
+		return "Editor"
+	case RoleAuthor:
+		return "Author"
+	case RoleViewer:
+		return "Viewer"
+	}
+	return role
+}
+
+// Can reports whether the user's role grants the permission
+func (u *User) Can(perm Permission) bool {
+	for _, p := range rolePermissions[u.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CanEditPost reports whether the user may edit or delete the post.
+// Authors are limited to posts they wrote.
+func (u *User) CanEditPost(post *Post) bool {
+	if u.Can(PermEditAnyPost) {
+		return true
+	}
+	return u.Can(PermEditOwnPosts) && post.AuthorID != nil && *post.AuthorID == u.ID
+}
@@ -3,11 +3,22 @@ package models
 import "time"
 
 type Session struct {
-	ID        int
-	UserID    int
-	Token     string
-	ExpiresAt time.Time
-	CreatedAt time.Time
+	ID             int
+	UserID         int
+	ImpersonatorID *int   // The admin viewing as UserID, for impersonation sessions
+	Token          string // Plaintext, only set when the session is created
+	TokenHash      string
+	UserAgent      string
+	IPAddress      string
+	LastSeenAt     time.Time
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+}
+
+// IsImpersonation reports whether an admin is using this session to view the
+// site as its user
+func (s *Session) IsImpersonation() bool {
+	return s.ImpersonatorID != nil
 }
 
 func (s *Session) IsExpired() bool {
@@ -3,14 +3,42 @@ package models
 import "time"
 
 type User struct {
-	ID        int
-	Email     string
-	Name      string
-	Role      string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          int     `json:"id"`
+	Email       string  `json:"email"`
+	Name        string  `json:"name"`
+	Role        string  `json:"role"`
+	Slug        string  `json:"slug"`
+	DisplayName string  `json:"display_name"`
+	Bio         string  `json:"bio"`
+	AvatarURL   *string `json:"avatar_url"`
+
+	FailedLoginCount int        `json:"failed_login_count"`
+	LockedUntil      *time.Time `json:"locked_until"`
+	MagicLinkEnabled bool       `json:"magic_link_enabled"` // Allow sign-in links by email
+	DeactivatedAt    *time.Time `json:"deactivated_at"`     // Set when an admin blocks sign-in
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 func (u *User) IsAdmin() bool {
-	return u.Role == "admin"
+	return u.Role == RoleAdmin
+}
+
+// IsLocked reports whether sign-in is temporarily blocked after failed attempts
+func (u *User) IsLocked() bool {
+	return u.LockedUntil != nil && time.Now().Before(*u.LockedUntil)
+}
+
+// IsDeactivated reports whether an admin has blocked the account from signing in
+func (u *User) IsDeactivated() bool {
+	return u.DeactivatedAt != nil
+}
+
+// PublicName is the name shown on bylines and author pages
+func (u *User) PublicName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Name
 }
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/models"
+)
+
+// Users stores accounts. Changes that could leave the site without an active
+// admin fail with ErrLastAdmin, checked in the same transaction as the change.
+type Users interface {
+	GetByID(ctx context.Context, id int) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	GetBySlug(ctx context.Context, slug string) (*models.User, error)
+	// GetByLogin returns the user a provider account is linked to
+	GetByLogin(ctx context.Context, provider, providerID string) (*models.User, error)
+	// List returns every user, newest first
+	List(ctx context.Context) ([]models.User, error)
+	ListAdmins(ctx context.Context) ([]models.User, error)
+	// CountActiveAdmins counts admins who can still sign in
+	CountActiveAdmins(ctx context.Context) (int, error)
+	EmailTaken(ctx context.Context, email string) (bool, error)
+	// SlugTaken reports whether a user other than exceptID has the slug
+	SlugTaken(ctx context.Context, slug string, exceptID int) (bool, error)
+
+	// Create inserts a user from its email, name, role and slug, filling in
+	// the rest. A taken email fails with ErrConflict.
+	Create(ctx context.Context, user *models.User) error
+	Update(ctx context.Context, id int, name, role string) (*models.User, error)
+	UpdateName(ctx context.Context, id int, name string) (*models.User, error)
+	UpdateProfile(ctx context.Context, id int, profile Profile) (*models.User, error)
+	SetMagicLinkEnabled(ctx context.Context, id int, enabled bool) (*models.User, error)
+
+	ChangeRole(ctx context.Context, id int, role string) (*models.User, error)
+	// Deactivate blocks the user from signing in and removes their sessions
+	// and outstanding sign-in links
+	Deactivate(ctx context.Context, id int) (*models.User, error)
+	Reactivate(ctx context.Context, id int) (*models.User, error)
+	// Delete deletes the user. Their posts are kept without an author unless
+	// they were reassigned first.
+	Delete(ctx context.Context, id int) error
+
+	// RecordLoginFailure bumps the user's failure count and returns it
+	RecordLoginFailure(ctx context.Context, id int) (int, error)
+	Lock(ctx context.Context, id int, until time.Time) error
+	// Unlock clears the failure count and any lockout
+	Unlock(ctx context.Context, id int) error
+}
+
+// Profile is the public part of a user's account
+type Profile struct {
+	Slug        string
+	DisplayName string
+	Bio         string
+	AvatarURL   *string
+}
+
+// Logins stores the ways users sign in: a password, or a linked provider
+// account
+type Logins interface {
+	GetByProvider(ctx context.Context, provider, providerID string) (*models.Login, error)
+	// GetForUser returns the user's login with the provider
+	GetForUser(ctx context.Context, userID int, provider string) (*models.Login, error)
+	// ListForUser returns the user's logins, oldest first
+	ListForUser(ctx context.Context, userID int) ([]models.Login, error)
+	CountForUser(ctx context.Context, userID int) (int, error)
+
+	// Create inserts the login and fills in its ID and timestamps
+	Create(ctx context.Context, login *models.Login) error
+	SetPasswordHash(ctx context.Context, userID int, hash string) error
+	// Link attaches a provider account to the user. Linking the same account
+	// again is a no-op; one linked to someone else fails with ErrConflict.
+	Link(ctx context.Context, userID int, provider, providerID string) (*models.Login, error)
+	// Delete removes one of the user's provider logins. Password logins are
+	// never removed here.
+	Delete(ctx context.Context, userID, loginID int) error
+}
+
+type Sessions interface {
+	GetByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error)
+	// ListActive returns the user's own unexpired sessions, leaving out
+	// impersonation sessions, most recently active first
+	ListActive(ctx context.Context, userID int) ([]models.Session, error)
+
+	// Create inserts the session and fills in its ID and timestamps
+	Create(ctx context.Context, session *models.Session) error
+	// Touch records activity on the session
+	Touch(ctx context.Context, id int) error
+
+	DeleteByTokenHash(ctx context.Context, tokenHash string) error
+	// Delete deletes one of the user's sessions
+	Delete(ctx context.Context, userID, id int) error
+	DeleteOthers(ctx context.Context, userID, keepID int) error
+	DeleteAll(ctx context.Context, userID int) error
+	DeleteExpired(ctx context.Context) error
+}
+
+type Invites interface {
+	GetByTokenHash(ctx context.Context, tokenHash string) (*models.Invite, error)
+	// ListPending returns invites that can still be used, newest first
+	ListPending(ctx context.Context) ([]models.Invite, error)
+	// History returns the most recent invites in any state, with the sender's
+	// name and the accounts registered through each
+	History(ctx context.Context, limit int) ([]models.Invite, error)
+
+	// Create inserts the invite and fills in its ID and timestamps
+	Create(ctx context.Context, invite *models.Invite) error
+	// Reissue gives a pending email invite a new token and restarts its
+	// expiry with the original validity period
+	Reissue(ctx context.Context, id int, tokenHash string) (*models.Invite, error)
+	MarkSent(ctx context.Context, id int) error
+	// Accept takes one use of a usable invite and records who accepted it
+	Accept(ctx context.Context, tokenHash string, userID int, email string) error
+	// Revoke stops a pending invite from being used
+	Revoke(ctx context.Context, id int) error
+	// DeleteExpired removes never-accepted invites that expired or were
+	// revoked before the given time, returning how many
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+// EmailChanges stores email addresses waiting to be confirmed
+type EmailChanges interface {
+	// Replace stores a pending change, discarding any earlier one for the user
+	Replace(ctx context.Context, userID int, newEmail, tokenHash string, expiresAt time.Time) error
+	// Confirm applies an unexpired change to the user and their password
+	// login. A taken email fails with ErrConflict.
+	Confirm(ctx context.Context, tokenHash string) (*models.User, error)
+}
+
+// LoginLinks stores emailed sign-in links
+type LoginLinks interface {
+	Create(ctx context.Context, userID int, tokenHash, ipAddress string, expiresAt time.Time) error
+	// Consume marks an unused, unexpired link used and returns its user
+	Consume(ctx context.Context, tokenHash string) (int, error)
+	DeleteUnused(ctx context.Context, userID int) error
+	DeleteExpired(ctx context.Context) error
+}
+
+type LoginAttempts interface {
+	Record(ctx context.Context, email, ipAddress string, succeeded bool) error
+	// CountFailures counts failed attempts from the IP since the given time
+	CountFailures(ctx context.Context, ipAddress string, since time.Time) (int, error)
+	// DeleteBefore removes attempts made before the given time and returns
+	// how many there were
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type APITokens interface {
+	GetByTokenHash(ctx context.Context, tokenHash string) (*models.APIToken, error)
+	// ListForUser returns the user's tokens, newest first
+	ListForUser(ctx context.Context, userID int) ([]models.APIToken, error)
+
+	// Create inserts the token and fills in its ID and creation time
+	Create(ctx context.Context, token *models.APIToken) error
+	Touch(ctx context.Context, id int) error
+	// Delete deletes one of the user's tokens
+	Delete(ctx context.Context, userID, id int) error
+}
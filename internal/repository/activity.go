@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/models"
+)
+
+type AuditEvents interface {
+	// Record stores the event. The actor's email is copied from their
+	// account, and an actor who no longer exists is recorded by
+	// event.ActorEmail alone.
+	Record(ctx context.Context, event *models.AuditEvent) error
+	// List returns matching events, newest first
+	List(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, error)
+	// Each calls fn with matching events, newest first, as they are read.
+	// It stops at the first error from fn and returns it.
+	Each(ctx context.Context, filter AuditFilter, fn func(event *models.AuditEvent) error) error
+}
+
+// AuditFilter narrows AuditEvents.List. Zero values match everything; Limit 0
+// means no limit.
+type AuditFilter struct {
+	ActorID    int
+	Action     string
+	TargetType string
+	TargetID   int
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+}
+
+// JobRuns stores the history of background job runs and decides which
+// replica runs each one
+type JobRuns interface {
+	// TryLock takes the job's lock if no other replica holds it. When ok is
+	// true, the caller must call unlock once the run is over.
+	TryLock(ctx context.Context, job string) (unlock func(), ok bool, err error)
+	// Start records a run as running, failing with ErrConflict if one has
+	// already been recorded for the job's scheduled time
+	Start(ctx context.Context, job string, scheduledFor time.Time, instance string) (int, error)
+	// Finish records a run's outcome. errMsg is empty unless it failed.
+	Finish(ctx context.Context, id int, status, errMsg string) error
+	// DeleteBefore deletes runs that started before the given time
+	DeleteBefore(ctx context.Context, before time.Time) error
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/ioverpi/personal-site/internal/models"
+)
+
+// Posts stores blog posts. Reads fill in the author's public name and slug.
+type Posts interface {
+	// ListPublished returns published posts, newest first
+	ListPublished(ctx context.Context) ([]models.Post, error)
+	ListPublishedByAuthor(ctx context.Context, authorID int) ([]models.Post, error)
+	// List returns every post, drafts included, most recently created first
+	List(ctx context.Context) ([]models.Post, error)
+	// ListPage returns up to limit posts in List's order, skipping the first
+	// offset
+	ListPage(ctx context.Context, limit, offset int) ([]models.Post, error)
+	// Count counts every post, drafts included
+	Count(ctx context.Context) (int, error)
+	GetByID(ctx context.Context, id int) (*models.Post, error)
+	GetBySlug(ctx context.Context, slug string) (*models.Post, error)
+
+	// Create inserts the post and fills in its ID and timestamps. A taken
+	// slug fails with ErrConflict.
+	Create(ctx context.Context, post *models.Post) error
+	// Update saves the post's title, slug, content and publish times
+	Update(ctx context.Context, post *models.Post) error
+	Delete(ctx context.Context, id int) error
+
+	// PublishScheduled publishes drafts whose scheduled time has passed,
+	// dated at the time they were scheduled for, and returns how many
+	PublishScheduled(ctx context.Context) (int64, error)
+	// CountByAuthor counts the user's posts, drafts included
+	CountByAuthor(ctx context.Context, authorID int) (int, error)
+	// Reassign moves all of one author's posts to another
+	Reassign(ctx context.Context, fromAuthorID, toAuthorID int) error
+}
+
+type Projects interface {
+	// List returns projects in display order
+	List(ctx context.Context) ([]models.Project, error)
+	// ListPage returns up to limit projects in List's order, skipping the
+	// first offset
+	ListPage(ctx context.Context, limit, offset int) ([]models.Project, error)
+	Count(ctx context.Context) (int, error)
+	GetByID(ctx context.Context, id int) (*models.Project, error)
+	// Create inserts the project and fills in its ID and creation time
+	Create(ctx context.Context, project *models.Project) error
+	Update(ctx context.Context, project *models.Project) error
+	Delete(ctx context.Context, id int) error
+}
+
+type Quotes interface {
+	// List returns quotes, newest first
+	List(ctx context.Context) ([]models.Quote, error)
+	// ListPage returns up to limit quotes in List's order, skipping the first
+	// offset
+	ListPage(ctx context.Context, limit, offset int) ([]models.Quote, error)
+	Count(ctx context.Context) (int, error)
+	GetByID(ctx context.Context, id int) (*models.Quote, error)
+	Random(ctx context.Context) (*models.Quote, error)
+	// Create inserts the quote and fills in its ID and creation time
+	Create(ctx context.Context, quote *models.Quote) error
+	Update(ctx context.Context, quote *models.Quote) error
+	Delete(ctx context.Context, id int) error
+}
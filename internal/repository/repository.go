@@ -0,0 +1,35 @@
+// Package repository defines how the services read and write the database.
+//
+// Each table the site uses has an interface here, implemented for both
+// databases in the sqlstore package. Lookups of a single record return
+// sql.ErrNoRows when it doesn't exist, as the services and controllers
+// already check for that error.
+package repository
+
+import "errors"
+
+var (
+	// ErrConflict is returned when a write would duplicate a unique value,
+	// such as a post's slug or a user's email
+	ErrConflict = errors.New("conflicts with an existing record")
+
+	ErrLastAdmin = errors.New("cannot remove the last admin")
+)
+
+// Repositories holds one implementation of every repository, all backed by
+// the same database
+type Repositories struct {
+	Posts         Posts
+	Projects      Projects
+	Quotes        Quotes
+	Users         Users
+	Logins        Logins
+	Sessions      Sessions
+	Invites       Invites
+	EmailChanges  EmailChanges
+	LoginLinks    LoginLinks
+	LoginAttempts LoginAttempts
+	APITokens     APITokens
+	AuditEvents   AuditEvents
+	JobRuns       JobRuns
+}
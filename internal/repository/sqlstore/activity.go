@@ -0,0 +1,176 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/repository"
+)
+
+// Audit events
+
+type AuditEventRepository struct {
+	store
+}
+
+func (r *AuditEventRepository) Record(ctx context.Context, event *models.AuditEvent) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO audit_events (actor_id, actor_email, action, target_type, target_id, before, after, request_id, ip_address, impersonator_email)
+		VALUES (
+			(SELECT id FROM users WHERE id = $1),
+			COALESCE((SELECT email FROM users WHERE id = $1), $9),
+			$2, $3, $4, $5, $6, $7, $8, $10
+		)
+	`, event.ActorID, event.Action, event.TargetType, event.TargetID, jsonText(event.Before), jsonText(event.After),
+		event.RequestID, event.IPAddress, event.ActorEmail, event.ImpersonatorEmail)
+	return err
+}
+
+func (r *AuditEventRepository) List(ctx context.Context, filter repository.AuditFilter) ([]models.AuditEvent, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var events []models.AuditEvent
+	err := r.each(ctx, filter, func(event *models.AuditEvent) error {
+		events = append(events, *event)
+		return nil
+	})
+	return events, err
+}
+
+// Each runs without the query timeout, since the rows are held open for as
+// long as fn takes; ctx still bounds it.
+func (r *AuditEventRepository) Each(ctx context.Context, filter repository.AuditFilter, fn func(event *models.AuditEvent) error) error {
+	return r.each(ctx, filter, fn)
+}
+
+func (r *AuditEventRepository) each(ctx context.Context, filter repository.AuditFilter, fn func(event *models.AuditEvent) error) error {
+	var conditions []string
+	var args []any
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.ActorID != 0 {
+		where("actor_id = $%d", filter.ActorID)
+	}
+	if filter.Action != "" {
+		where("action = $%d", filter.Action)
+	}
+	if filter.TargetType != "" {
+		where("target_type = $%d", filter.TargetType)
+	}
+	if filter.TargetID != 0 {
+		where("target_id = $%d", filter.TargetID)
+	}
+	if !filter.Since.IsZero() {
+		where("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("created_at < $%d", filter.Until)
+	}
+
+	query := `
+		SELECT id, actor_id, actor_email, impersonator_email, action, target_type, target_id,
+			before, after, request_id, ip_address, created_at
+		FROM audit_events`
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	}
+	query += "\n\t\tORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf("\n\t\tLIMIT $%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.AuditEvent
+		err := rows.Scan(
+			&event.ID, &event.ActorID, &event.ActorEmail, &event.ImpersonatorEmail, &event.Action,
+			&event.TargetType, &event.TargetID, &event.Before, &event.After,
+			&event.RequestID, &event.IPAddress, &event.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// jsonText passes a JSON snapshot as text. lib/pq would otherwise send
+// []byte as bytea, and SQLite would store it as a blob.
+func jsonText(data []byte) *string {
+	if data == nil {
+		return nil
+	}
+	s := string(data)
+	return &s
+}
+
+// Job runs
+
+type JobRunRepository struct {
+	store
+}
+
+// TryLock takes the job's lock, so only one replica runs it at a time
+func (r *JobRunRepository) TryLock(ctx context.Context, job string) (func(), bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.tryLock(ctx, r.db, job)
+}
+
+func (r *JobRunRepository) Start(ctx context.Context, job string, scheduledFor time.Time, instance string) (int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO job_runs (job_name, scheduled_for, instance)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (job_name, scheduled_for) DO NOTHING
+		RETURNING id
+	`, job, scheduledFor, instance).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, repository.ErrConflict
+	}
+	return id, err
+}
+
+func (r *JobRunRepository) Finish(ctx context.Context, id int, status, errMsg string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE job_runs
+		SET status = $1, error = NULLIF($2, ''), finished_at = NOW()
+		WHERE id = $3
+	`, status, errMsg, id)
+	return err
+}
+
+func (r *JobRunRepository) DeleteBefore(ctx context.Context, before time.Time) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM job_runs WHERE started_at < $1`, before)
+	return err
+}
@@ -0,0 +1,511 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/database"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/repository"
+)
+
+// Logins
+
+type LoginRepository struct {
+	store
+}
+
+// loginColumns lists the logins columns in the order scanLogin expects
+const loginColumns = `id, user_id, provider, provider_id, password_hash, created_at, updated_at`
+
+func (r *LoginRepository) GetByProvider(ctx context.Context, provider, providerID string) (*models.Login, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanLogin(r.db.QueryRowContext(ctx, `
+		SELECT `+loginColumns+`
+		FROM logins
+		WHERE provider = $1 AND provider_id = $2
+	`, provider, providerID))
+}
+
+func (r *LoginRepository) GetForUser(ctx context.Context, userID int, provider string) (*models.Login, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanLogin(r.db.QueryRowContext(ctx, `
+		SELECT `+loginColumns+`
+		FROM logins
+		WHERE user_id = $1 AND provider = $2
+	`, userID, provider))
+}
+
+func (r *LoginRepository) ListForUser(ctx context.Context, userID int) ([]models.Login, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+loginColumns+`
+		FROM logins
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logins []models.Login
+	for rows.Next() {
+		login, err := scanLogin(rows)
+		if err != nil {
+			return nil, err
+		}
+		logins = append(logins, *login)
+	}
+	return logins, rows.Err()
+}
+
+func (r *LoginRepository) CountForUser(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM logins WHERE user_id = $1`, userID).Scan(&count)
+	return count, err
+}
+
+func (r *LoginRepository) Create(ctx context.Context, login *models.Login) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO logins (user_id, provider, provider_id, password_hash)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`, login.UserID, login.Provider, login.ProviderID, login.PasswordHash).Scan(
+		&login.ID, &login.CreatedAt, &login.UpdatedAt,
+	)
+	return r.conflict(err)
+}
+
+func (r *LoginRepository) SetPasswordHash(ctx context.Context, userID int, hash string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE logins
+		SET password_hash = $1, updated_at = NOW()
+		WHERE user_id = $2 AND provider = $3
+	`, hash, userID, models.ProviderPassword)
+	return err
+}
+
+func (r *LoginRepository) Link(ctx context.Context, userID int, provider, providerID string) (*models.Login, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	login, err := scanLogin(r.db.QueryRowContext(ctx, `
+		INSERT INTO logins (user_id, provider, provider_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (provider, provider_id) DO UPDATE SET updated_at = NOW()
+		WHERE logins.user_id = $1
+		RETURNING `+loginColumns+`
+	`, userID, provider, providerID))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrConflict
+	}
+	return login, err
+}
+
+func (r *LoginRepository) Delete(ctx context.Context, userID, loginID int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM logins
+		WHERE id = $1 AND user_id = $2 AND provider <> $3
+	`, loginID, userID, models.ProviderPassword)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func scanLogin(row rowScanner) (*models.Login, error) {
+	var login models.Login
+	err := row.Scan(
+		&login.ID, &login.UserID, &login.Provider, &login.ProviderID,
+		&login.PasswordHash, &login.CreatedAt, &login.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
+
+// Sessions
+
+type SessionRepository struct {
+	store
+}
+
+// sessionColumns lists the sessions columns in the order scanSession expects
+const sessionColumns = `id, user_id, impersonator_id, token_hash, user_agent, ip_address,
+	last_seen_at, expires_at, created_at`
+
+func (r *SessionRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanSession(r.db.QueryRowContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE token_hash = $1
+	`, tokenHash))
+}
+
+func (r *SessionRepository) ListActive(ctx context.Context, userID int) ([]models.Session, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE user_id = $1 AND impersonator_id IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO sessions (user_id, impersonator_id, token_hash, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, last_seen_at, expires_at, created_at
+	`, session.UserID, session.ImpersonatorID, session.TokenHash, session.UserAgent, session.IPAddress,
+		session.ExpiresAt).Scan(&session.ID, &session.LastSeenAt, &session.ExpiresAt, &session.CreatedAt)
+}
+
+func (r *SessionRepository) Touch(ctx context.Context, id int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE sessions SET last_seen_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func (r *SessionRepository) DeleteByTokenHash(ctx context.Context, tokenHash string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE token_hash = $1`, tokenHash)
+	return err
+}
+
+func (r *SessionRepository) Delete(ctx context.Context, userID, id int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (r *SessionRepository) DeleteOthers(ctx context.Context, userID, keepID int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1 AND id <> $2`, userID, keepID)
+	return err
+}
+
+func (r *SessionRepository) DeleteAll(ctx context.Context, userID int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1`, userID)
+	return err
+}
+
+func (r *SessionRepository) DeleteExpired(ctx context.Context) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at < NOW()`)
+	return err
+}
+
+func scanSession(row rowScanner) (*models.Session, error) {
+	var session models.Session
+	err := row.Scan(
+		&session.ID, &session.UserID, &session.ImpersonatorID, &session.TokenHash,
+		&session.UserAgent, &session.IPAddress, &session.LastSeenAt,
+		&session.ExpiresAt, &session.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Email changes
+
+type EmailChangeRepository struct {
+	store
+}
+
+func (r *EmailChangeRepository) Replace(ctx context.Context, userID int, newEmail, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		// Only the most recent request can be confirmed
+		_, err := tx.ExecContext(ctx, `DELETE FROM email_changes WHERE user_id = $1`, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO email_changes (user_id, new_email, token_hash, expires_at)
+			VALUES ($1, $2, $3, $4)
+		`, userID, newEmail, tokenHash, expiresAt)
+		return err
+	})
+}
+
+func (r *EmailChangeRepository) Confirm(ctx context.Context, tokenHash string) (*models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var user *models.User
+	err := database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		var userID int
+		var newEmail string
+		err := tx.QueryRowContext(ctx, `
+			DELETE FROM email_changes
+			WHERE token_hash = $1 AND expires_at > NOW()
+			RETURNING user_id, new_email
+		`, tokenHash).Scan(&userID, &newEmail)
+		if err != nil {
+			return err
+		}
+
+		user, err = scanUser(tx.QueryRowContext(ctx, `
+			UPDATE users
+			SET email = $1, updated_at = NOW()
+			WHERE id = $2
+			RETURNING `+userColumns+`
+		`, newEmail, userID))
+		if err != nil {
+			return r.conflict(err)
+		}
+
+		// The password login's identifier is the email
+		_, err = tx.ExecContext(ctx, `
+			UPDATE logins
+			SET provider_id = $1, updated_at = NOW()
+			WHERE user_id = $2 AND provider = $3
+		`, newEmail, userID, models.ProviderPassword)
+		return err
+	})
+	return user, err
+}
+
+// Sign-in links
+
+type LoginLinkRepository struct {
+	store
+}
+
+func (r *LoginLinkRepository) Create(ctx context.Context, userID int, tokenHash, ipAddress string, expiresAt time.Time) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO login_links (user_id, token_hash, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, tokenHash, ipAddress, expiresAt)
+	return err
+}
+
+func (r *LoginLinkRepository) Consume(ctx context.Context, tokenHash string) (int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var userID int
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE login_links
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, tokenHash).Scan(&userID)
+	return userID, err
+}
+
+func (r *LoginLinkRepository) DeleteUnused(ctx context.Context, userID int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM login_links WHERE user_id = $1 AND used_at IS NULL`, userID)
+	return err
+}
+
+func (r *LoginLinkRepository) DeleteExpired(ctx context.Context) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM login_links WHERE expires_at < NOW()`)
+	return err
+}
+
+// Login attempts
+
+type LoginAttemptRepository struct {
+	store
+}
+
+func (r *LoginAttemptRepository) Record(ctx context.Context, email, ipAddress string, succeeded bool) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO login_attempts (email, ip_address, succeeded)
+		VALUES ($1, $2, $3)
+	`, email, ipAddress, succeeded)
+	return err
+}
+
+func (r *LoginAttemptRepository) CountFailures(ctx context.Context, ipAddress string, since time.Time) (int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var failures int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM login_attempts
+		WHERE ip_address = $1 AND NOT succeeded AND created_at > $2
+	`, ipAddress, since).Scan(&failures)
+	return failures, err
+}
+
+func (r *LoginAttemptRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// API tokens
+
+type APITokenRepository struct {
+	store
+}
+
+// apiTokenColumns lists the api_tokens columns in the order scanAPIToken expects
+const apiTokenColumns = `id, user_id, name, token_hash, scopes, expires_at, last_used_at, created_at`
+
+func (r *APITokenRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.scanAPIToken(r.db.QueryRowContext(ctx, `
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens
+		WHERE token_hash = $1
+	`, tokenHash))
+}
+
+func (r *APITokenRepository) ListForUser(ctx context.Context, userID int) ([]models.APIToken, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		token, err := r.scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *APITokenRepository) Create(ctx context.Context, token *models.APIToken) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO api_tokens (user_id, name, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, token.UserID, token.Name, token.TokenHash, r.strings(&token.Scopes), token.ExpiresAt).Scan(
+		&token.ID, &token.CreatedAt,
+	)
+}
+
+func (r *APITokenRepository) Touch(ctx context.Context, id int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func (r *APITokenRepository) Delete(ctx context.Context, userID, id int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (s store) scanAPIToken(row rowScanner) (*models.APIToken, error) {
+	var token models.APIToken
+	err := row.Scan(
+		&token.ID, &token.UserID, &token.Name, &token.TokenHash,
+		s.strings(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
@@ -0,0 +1,445 @@
+package sqlstore
+
+import (
+	"context"
+
+	"github.com/ioverpi/personal-site/internal/models"
+)
+
+// Posts
+
+type PostRepository struct {
+	store
+}
+
+// postColumns lists the posts columns, joined with the author as u, in the
+// order scanPost expects
+const postColumns = `p.id, p.title, p.slug, p.content, p.author_id,
+	COALESCE(NULLIF(u.display_name, ''), u.name, ''), COALESCE(u.slug, ''),
+	p.published_at, p.scheduled_at, p.created_at, p.updated_at`
+
+func (r *PostRepository) ListPublished(ctx context.Context) ([]models.Post, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.list(ctx, `
+		SELECT `+postColumns+`
+		FROM posts p
+		LEFT JOIN users u ON u.id = p.author_id
+		WHERE p.published_at IS NOT NULL
+		ORDER BY p.published_at DESC
+	`)
+}
+
+func (r *PostRepository) ListPublishedByAuthor(ctx context.Context, authorID int) ([]models.Post, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.list(ctx, `
+		SELECT `+postColumns+`
+		FROM posts p
+		LEFT JOIN users u ON u.id = p.author_id
+		WHERE p.published_at IS NOT NULL AND p.author_id = $1
+		ORDER BY p.published_at DESC
+	`, authorID)
+}
+
+func (r *PostRepository) List(ctx context.Context) ([]models.Post, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.list(ctx, `
+		SELECT `+postColumns+`
+		FROM posts p
+		LEFT JOIN users u ON u.id = p.author_id
+		ORDER BY p.created_at DESC
+	`)
+}
+
+func (r *PostRepository) ListPage(ctx context.Context, limit, offset int) ([]models.Post, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.list(ctx, `
+		SELECT `+postColumns+`
+		FROM posts p
+		LEFT JOIN users u ON u.id = p.author_id
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+}
+
+func (r *PostRepository) Count(ctx context.Context) (int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM posts`).Scan(&count)
+	return count, err
+}
+
+func (r *PostRepository) GetByID(ctx context.Context, id int) (*models.Post, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanPost(r.db.QueryRowContext(ctx, `
+		SELECT `+postColumns+`
+		FROM posts p
+		LEFT JOIN users u ON u.id = p.author_id
+		WHERE p.id = $1
+	`, id))
+}
+
+func (r *PostRepository) GetBySlug(ctx context.Context, slug string) (*models.Post, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanPost(r.db.QueryRowContext(ctx, `
+		SELECT `+postColumns+`
+		FROM posts p
+		LEFT JOIN users u ON u.id = p.author_id
+		WHERE p.slug = $1
+	`, slug))
+}
+
+func (r *PostRepository) Create(ctx context.Context, post *models.Post) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO posts (title, slug, content, author_id, published_at, scheduled_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`, post.Title, post.Slug, post.Content, post.AuthorID, post.PublishedAt, post.ScheduledAt).Scan(
+		&post.ID, &post.CreatedAt, &post.UpdatedAt,
+	)
+	return r.conflict(err)
+}
+
+func (r *PostRepository) Update(ctx context.Context, post *models.Post) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE posts
+		SET title = $1, slug = $2, content = $3, published_at = $4, scheduled_at = $5, updated_at = NOW()
+		WHERE id = $6
+		RETURNING author_id, created_at, updated_at
+	`, post.Title, post.Slug, post.Content, post.PublishedAt, post.ScheduledAt, post.ID).Scan(
+		&post.AuthorID, &post.CreatedAt, &post.UpdatedAt,
+	)
+	return r.conflict(err)
+}
+
+func (r *PostRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM posts WHERE id = $1`, id)
+	return err
+}
+
+func (r *PostRepository) PublishScheduled(ctx context.Context) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE posts
+		SET published_at = scheduled_at, scheduled_at = NULL, updated_at = NOW()
+		WHERE scheduled_at <= NOW() AND published_at IS NULL
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *PostRepository) CountByAuthor(ctx context.Context, authorID int) (int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM posts WHERE author_id = $1
+	`, authorID).Scan(&count)
+	return count, err
+}
+
+func (r *PostRepository) Reassign(ctx context.Context, fromAuthorID, toAuthorID int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE posts SET author_id = $1, updated_at = NOW() WHERE author_id = $2
+	`, toAuthorID, fromAuthorID)
+	return err
+}
+
+func (r *PostRepository) list(ctx context.Context, query string, args ...any) ([]models.Post, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *post)
+	}
+	return posts, rows.Err()
+}
+
+func scanPost(row rowScanner) (*models.Post, error) {
+	var post models.Post
+	err := row.Scan(
+		&post.ID, &post.Title, &post.Slug, &post.Content, &post.AuthorID,
+		&post.AuthorName, &post.AuthorSlug,
+		&post.PublishedAt, &post.ScheduledAt, &post.CreatedAt, &post.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// Projects
+
+type ProjectRepository struct {
+	store
+}
+
+// projectColumns lists the projects columns in the order scanProject expects
+const projectColumns = `id, name, description, tags, github_url, demo_url, display_order, created_at`
+
+func (r *ProjectRepository) List(ctx context.Context) ([]models.Project, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.list(ctx, `
+		SELECT `+projectColumns+`
+		FROM projects
+		ORDER BY display_order ASC, created_at DESC
+	`)
+}
+
+func (r *ProjectRepository) ListPage(ctx context.Context, limit, offset int) ([]models.Project, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.list(ctx, `
+		SELECT `+projectColumns+`
+		FROM projects
+		ORDER BY display_order ASC, created_at DESC, id DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+}
+
+func (r *ProjectRepository) Count(ctx context.Context) (int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM projects`).Scan(&count)
+	return count, err
+}
+
+func (r *ProjectRepository) list(ctx context.Context, query string, args ...any) ([]models.Project, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []models.Project
+	for rows.Next() {
+		project, err := r.scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, *project)
+	}
+	return projects, rows.Err()
+}
+
+func (r *ProjectRepository) GetByID(ctx context.Context, id int) (*models.Project, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.scanProject(r.db.QueryRowContext(ctx, `
+		SELECT `+projectColumns+`
+		FROM projects
+		WHERE id = $1
+	`, id))
+}
+
+func (r *ProjectRepository) Create(ctx context.Context, project *models.Project) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO projects (name, description, tags, github_url, demo_url, display_order, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, created_at
+	`, project.Name, project.Description, r.strings(&project.Tags), project.GithubURL, project.DemoURL,
+		project.DisplayOrder).Scan(&project.ID, &project.CreatedAt)
+}
+
+func (r *ProjectRepository) Update(ctx context.Context, project *models.Project) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, `
+		UPDATE projects
+		SET name = $1, description = $2, tags = $3, github_url = $4, demo_url = $5, display_order = $6
+		WHERE id = $7
+		RETURNING created_at
+	`, project.Name, project.Description, r.strings(&project.Tags), project.GithubURL, project.DemoURL,
+		project.DisplayOrder, project.ID).Scan(&project.CreatedAt)
+}
+
+func (r *ProjectRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM projects WHERE id = $1`, id)
+	return err
+}
+
+func (s store) scanProject(row rowScanner) (*models.Project, error) {
+	var project models.Project
+	err := row.Scan(
+		&project.ID, &project.Name, &project.Description,
+		s.strings(&project.Tags), &project.GithubURL, &project.DemoURL,
+		&project.DisplayOrder, &project.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// Quotes
+
+type QuoteRepository struct {
+	store
+}
+
+// quoteColumns lists the quotes columns in the order scanQuote expects
+const quoteColumns = `id, content, author, is_own, created_at`
+
+func (r *QuoteRepository) List(ctx context.Context) ([]models.Quote, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.list(ctx, `
+		SELECT `+quoteColumns+`
+		FROM quotes
+		ORDER BY created_at DESC
+	`)
+}
+
+func (r *QuoteRepository) ListPage(ctx context.Context, limit, offset int) ([]models.Quote, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.list(ctx, `
+		SELECT `+quoteColumns+`
+		FROM quotes
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+}
+
+func (r *QuoteRepository) Count(ctx context.Context) (int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM quotes`).Scan(&count)
+	return count, err
+}
+
+func (r *QuoteRepository) list(ctx context.Context, query string, args ...any) ([]models.Quote, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var quotes []models.Quote
+	for rows.Next() {
+		quote, err := scanQuote(rows)
+		if err != nil {
+			return nil, err
+		}
+		quotes = append(quotes, *quote)
+	}
+	return quotes, rows.Err()
+}
+
+func (r *QuoteRepository) GetByID(ctx context.Context, id int) (*models.Quote, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanQuote(r.db.QueryRowContext(ctx, `
+		SELECT `+quoteColumns+`
+		FROM quotes
+		WHERE id = $1
+	`, id))
+}
+
+func (r *QuoteRepository) Random(ctx context.Context) (*models.Quote, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanQuote(r.db.QueryRowContext(ctx, `
+		SELECT `+quoteColumns+`
+		FROM quotes
+		ORDER BY RANDOM()
+		LIMIT 1
+	`))
+}
+
+func (r *QuoteRepository) Create(ctx context.Context, quote *models.Quote) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO quotes (content, author, is_own, created_at)
+		VALUES ($1, $2, $3, NOW())
+		RETURNING id, created_at
+	`, quote.Content, quote.Author, quote.IsOwn).Scan(&quote.ID, &quote.CreatedAt)
+}
+
+func (r *QuoteRepository) Update(ctx context.Context, quote *models.Quote) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, `
+		UPDATE quotes
+		SET content = $1, author = $2, is_own = $3
+		WHERE id = $4
+		RETURNING created_at
+	`, quote.Content, quote.Author, quote.IsOwn, quote.ID).Scan(&quote.CreatedAt)
+}
+
+func (r *QuoteRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM quotes WHERE id = $1`, id)
+	return err
+}
+
+func scanQuote(row rowScanner) (*models.Quote, error) {
+	var quote models.Quote
+	err := row.Scan(&quote.ID, &quote.Content, &quote.Author, &quote.IsOwn, &quote.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
@@ -0,0 +1,168 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"github.com/ioverpi/personal-site/internal/database"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// dialect covers what the shared queries can't say the same way on both
+// databases
+type dialect interface {
+	// strings stores and scans a list column, such as a project's tags
+	strings(list *[]string) stringsValue
+
+	// inList returns a condition matching a column against ids, such as
+	// "= ANY($1)", and the argument to bind for $1
+	inList(ids []int) (cond string, arg any, err error)
+
+	// renewedExpiry is an expression moving expires_at forward to now plus
+	// the row's original validity period (expires_at - created_at)
+	renewedExpiry() string
+
+	// forUpdate is appended to a SELECT run in a transaction to lock the
+	// rows it returns until the transaction ends
+	forUpdate() string
+
+	// tryLock takes the lock named job for one replica at a time
+	tryLock(ctx context.Context, db database.Queryer, job string) (unlock func(), locked bool, err error)
+
+	isUniqueViolation(err error) bool
+}
+
+type stringsValue interface {
+	driver.Valuer
+	sql.Scanner
+}
+
+// postgresDialect stores lists as TEXT[] and locks jobs with advisory locks
+type postgresDialect struct{}
+
+func (postgresDialect) strings(list *[]string) stringsValue {
+	return (*pq.StringArray)(list)
+}
+
+func (postgresDialect) inList(ids []int) (string, any, error) {
+	list := make([]int64, len(ids))
+	for i, id := range ids {
+		list[i] = int64(id)
+	}
+	return "= ANY($1)", pq.Array(list), nil
+}
+
+func (postgresDialect) renewedExpiry() string {
+	return "NOW() + (expires_at - created_at)"
+}
+
+// forUpdate locks the rows, which the queries using it take in id order so
+// concurrent callers can't deadlock
+func (postgresDialect) forUpdate() string {
+	return " FOR UPDATE"
+}
+
+// jobLockNamespace is the first key of every job's advisory lock, keeping
+// them apart from any other advisory locks taken on the database
+const jobLockNamespace = 7401
+
+func (postgresDialect) tryLock(ctx context.Context, q database.Queryer, job string) (func(), bool, error) {
+	// Advisory locks belong to the session, so take and release the lock on
+	// the same connection
+	db, ok := database.Untraced(q).(*sql.DB)
+	if !ok {
+		return nil, false, errors.New("job locks cannot be taken inside a transaction")
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1, hashtext($2))`, jobLockNamespace, job).Scan(&locked)
+	if err != nil || !locked {
+		conn.Close()
+		return nil, false, err
+	}
+
+	return func() {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1, hashtext($2))`, jobLockNamespace, job)
+		conn.Close()
+	}, true, nil
+}
+
+func (postgresDialect) isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// sqliteDialect stores lists as JSON arrays. A SQLite database belongs to a
+// single server, so it needs no job locks.
+type sqliteDialect struct{}
+
+func (sqliteDialect) strings(list *[]string) stringsValue {
+	return stringList{list}
+}
+
+func (sqliteDialect) inList(ids []int) (string, any, error) {
+	list, err := json.Marshal(ids)
+	return "IN (SELECT value FROM json_each($1))", string(list), err
+}
+
+func (sqliteDialect) renewedExpiry() string {
+	return "strftime('%Y-%m-%d %H:%M:%f+00:00', julianday('now') + julianday(expires_at) - julianday(created_at))"
+}
+
+// forUpdate is empty: transactions take SQLite's write lock when they begin,
+// so nothing else can change the rows before the transaction ends
+func (sqliteDialect) forUpdate() string {
+	return ""
+}
+
+// tryLock always succeeds. The scheduler runs each job from one goroutine,
+// and the unique run per scheduled time in job_runs still guards against a
+// second process.
+func (sqliteDialect) tryLock(context.Context, database.Queryer, string) (func(), bool, error) {
+	return func() {}, true, nil
+}
+
+func (sqliteDialect) isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// stringList stores a []string as a JSON array, standing in for Postgres's
+// TEXT[]. A nil list is stored as NULL.
+type stringList struct {
+	list *[]string
+}
+
+func (l stringList) Value() (driver.Value, error) {
+	if *l.list == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(*l.list)
+	return string(data), err
+}
+
+func (l stringList) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*l.list = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(src), l.list)
+	case []byte:
+		return json.Unmarshal(src, l.list)
+	}
+	return errors.New("unsupported type for string list")
+}
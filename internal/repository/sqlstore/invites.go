@@ -0,0 +1,229 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/database"
+	"github.com/ioverpi/personal-site/internal/models"
+)
+
+type InviteRepository struct {
+	store
+}
+
+// inviteColumns lists the invites columns in the order scanInvite expects
+const inviteColumns = `id, COALESCE(email, ''), role, token_hash, COALESCE(invited_by, 0),
+	max_uses, use_count, used_at, revoked_at, last_sent_at, expires_at, created_at`
+
+const prefixedInviteColumns = `i.id, COALESCE(i.email, ''), i.role, i.token_hash, COALESCE(i.invited_by, 0),
+	i.max_uses, i.use_count, i.used_at, i.revoked_at, i.last_sent_at, i.expires_at, i.created_at`
+
+func (r *InviteRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*models.Invite, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanInvite(r.db.QueryRowContext(ctx, `
+		SELECT `+inviteColumns+`
+		FROM invites
+		WHERE token_hash = $1
+	`, tokenHash))
+}
+
+func (r *InviteRepository) ListPending(ctx context.Context) ([]models.Invite, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+inviteColumns+`
+		FROM invites
+		WHERE used_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []models.Invite
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, *invite)
+	}
+	return invites, rows.Err()
+}
+
+func (r *InviteRepository) History(ctx context.Context, limit int) ([]models.Invite, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+prefixedInviteColumns+`, COALESCE(u.name, '')
+		FROM invites i
+		LEFT JOIN users u ON u.id = i.invited_by
+		ORDER BY i.created_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []models.Invite
+	index := map[int]int{}
+	for rows.Next() {
+		var name string
+		invite, err := scanInvite(rows, &name)
+		if err != nil {
+			return nil, err
+		}
+		invite.InvitedByName = name
+		index[invite.ID] = len(invites)
+		invites = append(invites, *invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(invites) == 0 {
+		return invites, nil
+	}
+
+	ids := make([]int, 0, len(invites))
+	for _, invite := range invites {
+		ids = append(ids, invite.ID)
+	}
+	inIDs, idList, err := r.inList(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	acceptances, err := r.db.QueryContext(ctx, `
+		SELECT id, invite_id, user_id, email, accepted_at
+		FROM invite_acceptances
+		WHERE invite_id `+inIDs+`
+		ORDER BY accepted_at
+	`, idList)
+	if err != nil {
+		return nil, err
+	}
+	defer acceptances.Close()
+
+	for acceptances.Next() {
+		var a models.InviteAcceptance
+		if err := acceptances.Scan(&a.ID, &a.InviteID, &a.UserID, &a.Email, &a.AcceptedAt); err != nil {
+			return nil, err
+		}
+		i := index[a.InviteID]
+		invites[i].Acceptances = append(invites[i].Acceptances, a)
+	}
+	return invites, acceptances.Err()
+}
+
+func (r *InviteRepository) Create(ctx context.Context, invite *models.Invite) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	created, err := scanInvite(r.db.QueryRowContext(ctx, `
+		INSERT INTO invites (email, role, token_hash, invited_by, max_uses, expires_at)
+		VALUES (NULLIF($1, ''), $2, $3, $4, $5, $6)
+		RETURNING `+inviteColumns+`
+	`, invite.Email, invite.Role, invite.TokenHash, invite.InvitedBy, invite.MaxUses, invite.ExpiresAt))
+	if err != nil {
+		return err
+	}
+	*invite = *created
+	return nil
+}
+
+func (r *InviteRepository) Reissue(ctx context.Context, id int, tokenHash string) (*models.Invite, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanInvite(r.db.QueryRowContext(ctx, `
+		UPDATE invites
+		SET token_hash = $1, expires_at = `+r.renewedExpiry()+`
+		WHERE id = $2 AND email IS NOT NULL AND used_at IS NULL AND revoked_at IS NULL
+		RETURNING `+inviteColumns+`
+	`, tokenHash, id))
+}
+
+func (r *InviteRepository) MarkSent(ctx context.Context, id int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE invites SET last_sent_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func (r *InviteRepository) Accept(ctx context.Context, tokenHash string, userID int, email string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		var inviteID int
+		err := tx.QueryRowContext(ctx, `
+			UPDATE invites
+			SET use_count = use_count + 1,
+				used_at = CASE WHEN use_count + 1 >= max_uses THEN NOW() END
+			WHERE token_hash = $1 AND used_at IS NULL AND revoked_at IS NULL
+				AND expires_at > NOW() AND use_count < max_uses
+			RETURNING id
+		`, tokenHash).Scan(&inviteID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO invite_acceptances (invite_id, user_id, email)
+			VALUES ($1, $2, $3)
+		`, inviteID, userID, email)
+		return err
+	})
+}
+
+func (r *InviteRepository) Revoke(ctx context.Context, id int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE invites
+		SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL AND used_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (r *InviteRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM invites
+		WHERE use_count = 0 AND COALESCE(revoked_at, expires_at) < $1
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// scanInvite scans inviteColumns followed by any extra columns
+func scanInvite(row rowScanner, extra ...any) (*models.Invite, error) {
+	var invite models.Invite
+	dest := []any{
+		&invite.ID, &invite.Email, &invite.Role, &invite.TokenHash, &invite.InvitedBy,
+		&invite.MaxUses, &invite.UseCount, &invite.UsedAt, &invite.RevokedAt,
+		&invite.LastSentAt, &invite.ExpiresAt, &invite.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
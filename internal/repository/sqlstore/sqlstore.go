@@ -0,0 +1,90 @@
+// Package sqlstore implements the repositories on PostgreSQL and SQLite.
+//
+// Both databases run the same queries, written in Postgres's dialect where
+// SQLite accepts it. What SQLite doesn't accept goes through a dialect: list
+// columns (TEXT[] on Postgres, JSON arrays on SQLite), matching against a
+// list of ids, interval arithmetic, row locks, job locks, and recognising a
+// unique violation.
+//
+// On SQLite, timestamps are stored as UTC text in one format, written by the
+// driver and by the NOW() function that package database registers, so they
+// compare correctly as strings.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/database"
+	"github.com/ioverpi/personal-site/internal/repository"
+)
+
+// New returns repositories backed by db, which was opened by
+// database.Connect with the named driver (database.Postgres or
+// database.SQLite). Each call's queries are cancelled after queryTimeout, or
+// not at all when it is 0.
+func New(db database.Queryer, driver string, queryTimeout time.Duration) *repository.Repositories {
+	var d dialect = postgresDialect{}
+	if driver == database.SQLite {
+		d = sqliteDialect{}
+	}
+
+	s := store{dialect: d, db: db, timeout: queryTimeout}
+	return &repository.Repositories{
+		Posts:         &PostRepository{s},
+		Projects:      &ProjectRepository{s},
+		Quotes:        &QuoteRepository{s},
+		Users:         &UserRepository{s},
+		Logins:        &LoginRepository{s},
+		Sessions:      &SessionRepository{s},
+		Invites:       &InviteRepository{s},
+		EmailChanges:  &EmailChangeRepository{s},
+		LoginLinks:    &LoginLinkRepository{s},
+		LoginAttempts: &LoginAttemptRepository{s},
+		APITokens:     &APITokenRepository{s},
+		AuditEvents:   &AuditEventRepository{s},
+		JobRuns:       &JobRunRepository{s},
+	}
+}
+
+// store is embedded in every repository for the dialect, the database or the
+// transaction the repositories were made for, and the query timeout
+type store struct {
+	dialect
+	db      database.Queryer
+	timeout time.Duration
+}
+
+// withTimeout bounds ctx by the query timeout
+func (s store) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// conflict turns a unique violation into repository.ErrConflict
+func (s store) conflict(err error) error {
+	if s.isUniqueViolation(err) {
+		return repository.ErrConflict
+	}
+	return err
+}
+
+// requireRow returns sql.ErrNoRows if result affected no rows
+func requireRow(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
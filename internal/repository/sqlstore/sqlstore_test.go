@@ -0,0 +1,173 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/database"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/repository"
+	"github.com/ioverpi/personal-site/migrations"
+)
+
+// newSQLite returns repositories over a migrated in-memory SQLite database
+func newSQLite(t *testing.T) *repository.Repositories {
+	t.Helper()
+
+	db, err := database.Connect("sqlite::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	database.MigrationsFS = migrations.FS
+	if err := database.Migrate(context.Background(), db, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	return New(db, database.SQLite, 0)
+}
+
+func TestSQLiteSmoke(t *testing.T) {
+	ctx := context.Background()
+	repos := newSQLite(t)
+
+	admin := &models.User{Email: "admin@example.com", Name: "Admin", Role: models.RoleAdmin, Slug: "admin"}
+	if err := repos.Users.Create(ctx, admin); err != nil {
+		t.Fatal(err)
+	}
+	dup := &models.User{Email: "admin@example.com", Name: "Other", Role: models.RoleViewer, Slug: "other"}
+	if err := repos.Users.Create(ctx, dup); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("creating a user with a taken email: got %v, want ErrConflict", err)
+	}
+	if _, err := repos.Users.ChangeRole(ctx, admin.ID, models.RoleViewer); !errors.Is(err, repository.ErrLastAdmin) {
+		t.Errorf("demoting the last admin: got %v, want ErrLastAdmin", err)
+	}
+
+	post := &models.Post{Title: "Hello", Slug: "hello", Content: "First post", AuthorID: &admin.ID}
+	if err := repos.Posts.Create(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repos.Posts.GetBySlug(ctx, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != post.ID || got.AuthorName != "Admin" {
+		t.Errorf("got post %d by %q, want %d by %q", got.ID, got.AuthorName, post.ID, "Admin")
+	}
+
+	second := &models.Post{Title: "Again", Slug: "again", Content: "Second post"}
+	if err := repos.Posts.Create(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := repos.Posts.Count(ctx); err != nil || count != 2 {
+		t.Errorf("Count: got %d, %v, want 2", count, err)
+	}
+	page, err := repos.Posts.ListPage(ctx, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].ID != post.ID {
+		t.Errorf("got second page %+v, want the first post only", page)
+	}
+
+	project := &models.Project{Name: "Site", Description: "This site", Tags: []string{"go", "sqlite"}}
+	if err := repos.Projects.Create(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	gotProject, err := repos.Projects.GetByID(ctx, project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(gotProject.Tags, project.Tags) {
+		t.Errorf("got tags %q, want %q", gotProject.Tags, project.Tags)
+	}
+
+	invite := &models.Invite{
+		Role:      models.RoleAuthor,
+		TokenHash: "hash",
+		InvitedBy: admin.ID,
+		MaxUses:   2,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := repos.Invites.Create(ctx, invite); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Invites.Accept(ctx, "hash", admin.ID, admin.Email); err != nil {
+		t.Fatal(err)
+	}
+	history, err := repos.Invites.History(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || len(history[0].Acceptances) != 1 || history[0].UseCount != 1 {
+		t.Fatalf("got invite history %+v, want one invite with one acceptance", history)
+	}
+
+	emailInvite := &models.Invite{
+		Email:     "new@example.com",
+		Role:      models.RoleAuthor,
+		TokenHash: "old",
+		InvitedBy: admin.ID,
+		MaxUses:   1,
+		ExpiresAt: time.Now().Add(48 * time.Hour),
+	}
+	if err := repos.Invites.Create(ctx, emailInvite); err != nil {
+		t.Fatal(err)
+	}
+	reissued, err := repos.Invites.Reissue(ctx, emailInvite.ID, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid := time.Until(reissued.ExpiresAt); valid < 47*time.Hour || valid > 49*time.Hour {
+		t.Errorf("reissued invite is valid for %v, want 48h", valid)
+	}
+
+	unlock, ok, err := repos.JobRuns.TryLock(ctx, "cleanup")
+	if err != nil || !ok {
+		t.Fatalf("TryLock: got %v, %v", ok, err)
+	}
+	unlock()
+}
+
+func TestLoginAttemptsDeleteBefore(t *testing.T) {
+	ctx := context.Background()
+	repos := newSQLite(t)
+
+	if err := repos.LoginAttempts.Record(ctx, "admin@example.com", "192.0.2.1", false); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := repos.LoginAttempts.DeleteBefore(ctx, time.Now().Add(-time.Hour)); err != nil || removed != 0 {
+		t.Errorf("deleting older attempts: removed %d (%v), want 0", removed, err)
+	}
+	if removed, err := repos.LoginAttempts.DeleteBefore(ctx, time.Now().Add(time.Minute)); err != nil || removed != 1 {
+		t.Errorf("deleting all attempts: removed %d (%v), want 1", removed, err)
+	}
+}
+
+func TestAuditEventsEach(t *testing.T) {
+	ctx := context.Background()
+	repos := newSQLite(t)
+
+	for _, action := range []string{models.AuditUserChangeEmail, models.AuditUserDelete} {
+		event := &models.AuditEvent{Action: action, TargetType: models.AuditTargetUser, ActorEmail: "admin@example.com"}
+		if err := repos.AuditEvents.Record(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var seen []string
+	stop := errors.New("stop")
+	err := repos.AuditEvents.Each(ctx, repository.AuditFilter{}, func(event *models.AuditEvent) error {
+		seen = append(seen, event.Action)
+		return stop
+	})
+	if err != stop {
+		t.Errorf("Each returned %v, want the callback's error", err)
+	}
+	if !slices.Equal(seen, []string{models.AuditUserDelete}) {
+		t.Errorf("saw %v, want only the newest event", seen)
+	}
+}
@@ -0,0 +1,374 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/database"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/repository"
+)
+
+type UserRepository struct {
+	store
+}
+
+// userColumns lists the users columns in the order scanUser expects
+const userColumns = `id, email, name, role, slug, display_name, bio, avatar_url,
+	failed_login_count, locked_until, magic_link_enabled, deactivated_at,
+	created_at, updated_at`
+
+func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanUser(r.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE id = $1
+	`, id))
+}
+
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanUser(r.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE email = $1
+	`, email))
+}
+
+func (r *UserRepository) GetBySlug(ctx context.Context, slug string) (*models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanUser(r.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE slug = $1
+	`, slug))
+}
+
+func (r *UserRepository) GetByLogin(ctx context.Context, provider, providerID string) (*models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanUser(r.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE id = (SELECT user_id FROM logins WHERE provider = $1 AND provider_id = $2)
+	`, provider, providerID))
+}
+
+func (r *UserRepository) List(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.list(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		ORDER BY created_at DESC
+	`)
+}
+
+func (r *UserRepository) ListAdmins(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.list(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE role = $1
+		ORDER BY created_at DESC
+	`, models.RoleAdmin)
+}
+
+func (r *UserRepository) CountActiveAdmins(ctx context.Context) (int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM users WHERE role = $1 AND deactivated_at IS NULL
+	`, models.RoleAdmin).Scan(&count)
+	return count, err
+}
+
+func (r *UserRepository) EmailTaken(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var taken bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)
+	`, email).Scan(&taken)
+	return taken, err
+}
+
+func (r *UserRepository) SlugTaken(ctx context.Context, slug string, exceptID int) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var taken bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE slug = $1 AND id <> $2)
+	`, slug, exceptID).Scan(&taken)
+	return taken, err
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	created, err := scanUser(r.db.QueryRowContext(ctx, `
+		INSERT INTO users (email, name, role, slug)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+userColumns+`
+	`, user.Email, user.Name, user.Role, user.Slug))
+	if err != nil {
+		return r.conflict(err)
+	}
+	*user = *created
+	return nil
+}
+
+func (r *UserRepository) Update(ctx context.Context, id int, name, role string) (*models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanUser(r.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET name = $1, role = $2, updated_at = NOW()
+		WHERE id = $3
+		RETURNING `+userColumns+`
+	`, name, role, id))
+}
+
+func (r *UserRepository) UpdateName(ctx context.Context, id int, name string) (*models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanUser(r.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET name = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING `+userColumns+`
+	`, name, id))
+}
+
+func (r *UserRepository) UpdateProfile(ctx context.Context, id int, profile repository.Profile) (*models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET slug = $1, display_name = $2, bio = $3, avatar_url = $4, updated_at = NOW()
+		WHERE id = $5
+		RETURNING `+userColumns+`
+	`, profile.Slug, profile.DisplayName, profile.Bio, profile.AvatarURL, id))
+	if err != nil {
+		return nil, r.conflict(err)
+	}
+	return user, nil
+}
+
+func (r *UserRepository) SetMagicLinkEnabled(ctx context.Context, id int, enabled bool) (*models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanUser(r.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET magic_link_enabled = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING `+userColumns+`
+	`, enabled, id))
+}
+
+func (r *UserRepository) ChangeRole(ctx context.Context, id int, role string) (*models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var user *models.User
+	err := database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		if role != models.RoleAdmin {
+			if err := r.guardLastAdmin(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		user, err = scanUser(tx.QueryRowContext(ctx, `
+			UPDATE users
+			SET role = $1, updated_at = NOW()
+			WHERE id = $2
+			RETURNING `+userColumns+`
+		`, role, id))
+		return err
+	})
+	return user, err
+}
+
+func (r *UserRepository) Deactivate(ctx context.Context, id int) (*models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var user *models.User
+	err := database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		if err := r.guardLastAdmin(ctx, tx, id); err != nil {
+			return err
+		}
+
+		var err error
+		user, err = scanUser(tx.QueryRowContext(ctx, `
+			UPDATE users
+			SET deactivated_at = COALESCE(deactivated_at, NOW()), updated_at = NOW()
+			WHERE id = $1
+			RETURNING `+userColumns+`
+		`, id))
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1`, id); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM login_links WHERE user_id = $1`, id)
+		return err
+	})
+	return user, err
+}
+
+func (r *UserRepository) Reactivate(ctx context.Context, id int) (*models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return scanUser(r.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET deactivated_at = NULL, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+userColumns+`
+	`, id))
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		if err := r.guardLastAdmin(ctx, tx, id); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+		return requireRow(result)
+	})
+}
+
+func (r *UserRepository) RecordLoginFailure(ctx context.Context, id int) (int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var failures int
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET failed_login_count = failed_login_count + 1
+		WHERE id = $1
+		RETURNING failed_login_count
+	`, id).Scan(&failures)
+	return failures, err
+}
+
+func (r *UserRepository) Lock(ctx context.Context, id int, until time.Time) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET locked_until = $1 WHERE id = $2`, until, id)
+	return err
+}
+
+func (r *UserRepository) Unlock(ctx context.Context, id int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE users
+		SET failed_login_count = 0, locked_until = NULL
+		WHERE id = $1 AND (failed_login_count > 0 OR locked_until IS NOT NULL)
+	`, id)
+	return err
+}
+
+func (r *UserRepository) list(ctx context.Context, query string, args ...any) ([]models.User, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+// guardLastAdmin returns ErrLastAdmin if removing the user's admin access
+// would leave no active admin. The active admin rows stay locked until the
+// transaction ends (see dialect.forUpdate), so no concurrent change can slip
+// in between the check and the caller's update.
+func (s store) guardLastAdmin(ctx context.Context, tx *sql.Tx, id int) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id FROM users
+		WHERE role = $1 AND deactivated_at IS NULL
+		ORDER BY id
+	`+s.forUpdate(), models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	isAdmin, others := false, 0
+	for rows.Next() {
+		var adminID int
+		if err := rows.Scan(&adminID); err != nil {
+			return err
+		}
+		if adminID == id {
+			isAdmin = true
+		} else {
+			others++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if isAdmin && others == 0 {
+		return repository.ErrLastAdmin
+	}
+	return nil
+}
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID, &user.Email, &user.Name, &user.Role,
+		&user.Slug, &user.DisplayName, &user.Bio, &user.AvatarURL,
+		&user.FailedLoginCount, &user.LockedUntil, &user.MagicLinkEnabled,
+		&user.DeactivatedAt, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,239 @@
+// Package scheduler runs named background jobs on cron-style schedules.
+//
+// Every replica of the server runs the same scheduler. Before a job runs, the
+// replica takes the job's lock from the run history (an advisory lock on
+// Postgres), so only one replica runs each job at a time. Each run is also
+// recorded in job_runs under its scheduled time, and a replica that finds the
+// run already recorded skips it, so a job runs once per scheduled time even
+// when replicas' clocks drift.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/metrics"
+	"github.com/ioverpi/personal-site/internal/repository"
+	"github.com/ioverpi/personal-site/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HeartbeatInterval is how often each waiting job loop records a heartbeat.
+// A loop that misses several, because its job is stuck or the loop has
+// exited, fails CheckHeartbeat.
+const HeartbeatInterval = 15 * time.Second
+
+var ErrNoHeartbeat = errors.New("scheduler has no recent heartbeat")
+
+// Run statuses recorded in job_runs
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+type job struct {
+	name     string
+	schedule *Schedule
+	run      func(ctx context.Context) error
+}
+
+type Scheduler struct {
+	runs     repository.JobRuns
+	instance string
+	jobs     []job
+
+	stop       chan struct{}
+	runCtx     context.Context
+	cancelRuns context.CancelFunc
+	wg         sync.WaitGroup
+
+	started atomic.Bool
+	beats   []atomic.Int64 // Unix nanoseconds of each job loop's last heartbeat
+}
+
+func New(runs repository.JobRuns) *Scheduler {
+	hostname, _ := os.Hostname()
+	runCtx, cancelRuns := context.WithCancel(context.Background())
+	return &Scheduler{
+		runs:       runs,
+		instance:   fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		stop:       make(chan struct{}),
+		runCtx:     runCtx,
+		cancelRuns: cancelRuns,
+	}
+}
+
+// Add registers a job. The name identifies the job across replicas and in the
+// run history, so it should not change between releases.
+func (s *Scheduler) Add(name, spec string, run func(ctx context.Context) error) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	s.jobs = append(s.jobs, job{name: name, schedule: schedule, run: run})
+	return nil
+}
+
+// Start runs each job on its schedule until Stop is called
+func (s *Scheduler) Start() {
+	s.beats = make([]atomic.Int64, len(s.jobs))
+	for i, j := range s.jobs {
+		s.beats[i].Store(time.Now().UnixNano())
+		s.wg.Add(1)
+		go s.loop(i, j)
+	}
+	s.started.Store(true)
+
+	slog.Info("scheduler started", "jobs", len(s.jobs), "instance", s.instance)
+}
+
+// Stop stops scheduling new runs and waits for running jobs to finish. If ctx
+// ends first, the running jobs' contexts are cancelled and Stop returns
+// ctx's error without waiting further.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	close(s.stop)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.cancelRuns()
+		return nil
+	case <-ctx.Done():
+		s.cancelRuns()
+		return ctx.Err()
+	}
+}
+
+// CheckHeartbeat returns ErrNoHeartbeat if the scheduler hasn't been started
+// or a job loop has missed several heartbeats. A run that takes longer than
+// that counts as stuck. Heartbeats stop with the scheduler, but the last ones
+// stay recent through a graceful shutdown.
+func (s *Scheduler) CheckHeartbeat(ctx context.Context) error {
+	if !s.started.Load() {
+		return ErrNoHeartbeat
+	}
+	for i, j := range s.jobs {
+		if age := time.Since(time.Unix(0, s.beats[i].Load())); age > 3*HeartbeatInterval {
+			return fmt.Errorf("%w: job %s last one %s ago", ErrNoHeartbeat, j.name, age.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) loop(i int, j job) {
+	defer s.wg.Done()
+
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			slog.Warn("job schedule never matches", "job", j.name)
+			return
+		}
+		if !s.wait(i, next) {
+			return
+		}
+
+		s.runOnce(j, next)
+	}
+}
+
+// wait sleeps until next, recording job i's heartbeat at least every
+// HeartbeatInterval. It returns false if the scheduler stops first.
+func (s *Scheduler) wait(i int, next time.Time) bool {
+	for {
+		s.beats[i].Store(time.Now().UnixNano())
+		remaining := time.Until(next)
+		if remaining <= 0 {
+			return true
+		}
+
+		timer := time.NewTimer(min(remaining, HeartbeatInterval))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// runOnce runs the job for its scheduled time if this replica wins the job's
+// lock and no other replica has already run it
+func (s *Scheduler) runOnce(j job, scheduledFor time.Time) {
+	ctx, span := tracing.Start(s.runCtx, "job "+j.name, trace.WithAttributes(
+		attribute.String("job.name", j.name),
+		attribute.String("job.instance", s.instance),
+	))
+	defer span.End()
+
+	unlock, locked, err := s.runs.TryLock(ctx, j.name)
+	if err != nil {
+		slog.Error("job failed to take lock", "job", j.name, "error", err)
+		return
+	}
+	if !locked {
+		slog.Debug("job running on another instance", "job", j.name)
+		return
+	}
+	defer unlock()
+
+	runID, err := s.runs.Start(ctx, j.name, scheduledFor, s.instance)
+	if errors.Is(err, repository.ErrConflict) {
+		slog.Debug("job already ran on another instance", "job", j.name, "scheduled_for", scheduledFor)
+		return
+	}
+	if err != nil {
+		slog.Error("job failed to record run", "job", j.name, "error", err)
+		return
+	}
+
+	start := time.Now()
+	runErr := s.call(ctx, j)
+	duration := time.Since(start)
+	tracing.RecordError(span, runErr)
+
+	status, errMsg := StatusSucceeded, ""
+	if runErr != nil {
+		status = StatusFailed
+		errMsg = runErr.Error()
+		slog.Error("job failed", "job", j.name, "duration", duration, "error", runErr)
+	} else {
+		slog.Info("job finished", "job", j.name, "duration", duration)
+	}
+	metrics.JobDuration.WithLabelValues(j.name, status).Observe(duration.Seconds())
+
+	// Record the outcome even if the run was cancelled by shutdown
+	err = s.runs.Finish(context.WithoutCancel(ctx), runID, status, errMsg)
+	if err != nil {
+		slog.Error("job failed to record result", "job", j.name, "error", err)
+	}
+}
+
+// call runs the job, turning a panic into an error so one bad job can't take
+// down the server
+func (s *Scheduler) call(ctx context.Context, j job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.run(ctx)
+}
+
+// PruneHistory deletes job runs that started more than retention ago
+func (s *Scheduler) PruneHistory(ctx context.Context, retention time.Duration) error {
+	return s.runs.DeleteBefore(ctx, time.Now().Add(-retention))
+}
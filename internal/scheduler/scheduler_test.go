@@ -0,0 +1,114 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// Monday 19 October 2026
+	from := time.Date(2026, 10, 19, 10, 7, 30, 0, time.UTC)
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", at(10, 19, 10, 8)},
+		{"*/15 * * * *", at(10, 19, 10, 15)},
+		{"0 * * * *", at(10, 19, 11, 0)},
+		{"@hourly", at(10, 19, 11, 0)},
+		{"30 3 * * *", at(10, 20, 3, 30)},
+		{"@daily", at(10, 20, 0, 0)},
+		{"0 9-17/4 * * *", at(10, 19, 13, 0)},
+		{"5,35 10 * * *", at(10, 19, 10, 35)},
+		{"0 9 * * 1-5", at(10, 20, 9, 0)},
+		{"0 0 * * 0", at(10, 25, 0, 0)},
+		{"0 0 * * 7", at(10, 25, 0, 0)},
+		{"@weekly", at(10, 25, 0, 0)},
+		{"0 0 1 * *", at(11, 1, 0, 0)},
+		{"0 0 1 1 *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+
+		// Both day fields restricted: either may match
+		{"0 0 13 * 5", at(10, 23, 0, 0)},
+		// A day field starting with * is unrestricted, so both must match:
+		// the next odd day that is a Monday
+		{"0 0 */2 * 1", at(11, 9, 0, 0)},
+		{"0 0 1 * */2", at(11, 1, 0, 0)},
+
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: Next = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleNextIsAfter(t *testing.T) {
+	s, err := ParseSchedule("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	if got, want := s.Next(from), from.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", from, got, want)
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@sometimes",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestCheckHeartbeat(t *testing.T) {
+	s := New(nil)
+	if err := s.Add("yearly", "@yearly", func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CheckHeartbeat(context.Background()); !errors.Is(err, ErrNoHeartbeat) {
+		t.Errorf("before Start: got %v, want ErrNoHeartbeat", err)
+	}
+
+	s.Start()
+	if err := s.CheckHeartbeat(context.Background()); err != nil {
+		t.Errorf("after Start: got %v, want nil", err)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CheckHeartbeat(context.Background()); err != nil {
+		t.Errorf("just after Stop: got %v, want nil", err)
+	}
+
+	// A loop that stopped recording heartbeats a while ago, as when its job
+	// hangs or the loop exits, fails the check
+	s.beats[0].Store(time.Now().Add(-4 * HeartbeatInterval).UnixNano())
+	if err := s.CheckHeartbeat(context.Background()); !errors.Is(err, ErrNoHeartbeat) {
+		t.Errorf("stale loop: got %v, want ErrNoHeartbeat", err)
+	}
+}
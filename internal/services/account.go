@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	netmail "net/mail"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/adapters/mail"
+	"github.com/ioverpi/personal-site/internal/adapters/oauth"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/repository"
+	"github.com/ioverpi/personal-site/internal/tracing"
+)
+
+// EmailChangeDuration is how long an email change confirmation link is valid
+const EmailChangeDuration = 24 * time.Hour
+
+var (
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrEmailTaken         = errors.New("email address is already in use")
+	ErrInvalidEmailChange = errors.New("invalid or expired email confirmation link")
+	ErrLoginAlreadyLinked = errors.New("login is already linked to an account")
+	ErrLastLogin          = errors.New("cannot remove the only way to sign in")
+	ErrLastAdmin          = repository.ErrLastAdmin
+)
+
+// Passwords
+
+// VerifyPassword checks the user's current password. Users without a
+// password login (OAuth only) always pass. Failures count towards the same
+// IP throttle and account lockout as signing in.
+func (s *AuthService) VerifyPassword(ctx context.Context, user *models.User, password, ipAddress string) error {
+	ctx, span := tracing.Start(ctx, "AuthService.VerifyPassword")
+	defer span.End()
+
+	login, err := s.getPasswordLogin(ctx, user.ID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	blocked, err := s.isIPThrottled(ctx, ipAddress)
+	if err != nil {
+		return err
+	}
+	if blocked || user.IsLocked() {
+		s.recordLoginAttempt(ctx, user.Email, ipAddress, false)
+		return ErrTooManyAttempts
+	}
+
+	if login.PasswordHash == nil || !CheckPassword(password, *login.PasswordHash) {
+		s.recordLoginAttempt(ctx, user.Email, ipAddress, false)
+		if err := s.recordAccountFailure(ctx, user, ipAddress); err != nil {
+			return err
+		}
+		return ErrInvalidCredentials
+	}
+
+	s.recordLoginAttempt(ctx, user.Email, ipAddress, true)
+	return s.UnlockUser(ctx, user.ID)
+}
+
+// CheckNewPassword applies the password policy to a password being set.
+// userInputs are the account's email, name and the like.
+func (s *AuthService) CheckNewPassword(ctx context.Context, password string, userInputs ...string) error {
+	ctx, span := tracing.Start(ctx, "AuthService.CheckNewPassword")
+	defer span.End()
+	return s.passwords.Check(ctx, password, userInputs...)
+}
+
+// ChangePassword sets a new password after checking the current one, adding a
+// password login if the user did not have one.
+func (s *AuthService) ChangePassword(ctx context.Context, user *models.User, currentPassword, newPassword, ipAddress string) error {
+	ctx, span := tracing.Start(ctx, "AuthService.ChangePassword")
+	defer span.End()
+
+	if err := s.VerifyPassword(ctx, user, currentPassword, ipAddress); err != nil {
+		return err
+	}
+	if err := s.CheckNewPassword(ctx, newPassword, user.Email, user.Name); err != nil {
+		return err
+	}
+
+	_, err := s.getPasswordLogin(ctx, user.ID)
+	if err == sql.ErrNoRows {
+		_, err = s.CreatePasswordLogin(ctx, user.ID, user.Email, newPassword)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.UpdatePassword(ctx, user.ID, newPassword)
+}
+
+func (s *AuthService) getPasswordLogin(ctx context.Context, userID int) (*models.Login, error) {
+	return s.app.Repos.Logins.GetForUser(ctx, userID, models.ProviderPassword)
+}
+
+// Email changes
+
+// ValidateEmail checks that email is a bare address, without a display name
+func ValidateEmail(email string) error {
+	if addr, err := netmail.ParseAddress(email); err != nil || addr.Address != email {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// RequestEmailChange emails a confirmation link to the new address and a
+// heads-up to the current one. The change only happens once the link is used.
+func (s *AuthService) RequestEmailChange(ctx context.Context, user *models.User, newEmail, password, ipAddress string) error {
+	ctx, span := tracing.Start(ctx, "AuthService.RequestEmailChange")
+	defer span.End()
+
+	newEmail = strings.TrimSpace(newEmail)
+	if err := ValidateEmail(newEmail); err != nil {
+		return err
+	}
+	if err := s.VerifyPassword(ctx, user, password, ipAddress); err != nil {
+		return err
+	}
+
+	taken, err := s.app.Repos.Users.EmailTaken(ctx, newEmail)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+
+	token, err := GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	// Only the most recent request can be confirmed
+	err = s.app.Repos.EmailChanges.Replace(ctx, user.ID, newEmail, HashToken(token), time.Now().Add(EmailChangeDuration))
+	if err != nil {
+		return err
+	}
+
+	link := s.app.Config.BaseURL + "/admin/account/email/confirm?token=" + url.QueryEscape(token)
+	err = s.app.Mailer.Send(mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf(`Hi %s,
+
+Confirm that you want to use this address for your account:
+
+%s
+
+The link expires in 24 hours. If you didn't ask for this, you can ignore
+this email.
+`, user.Name, link),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.app.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Email change requested",
+		Body: fmt.Sprintf(`Hi %s,
+
+Someone signed in to your account asked to change its email address to
+%s. Nothing changes until that address confirms.
+
+If this wasn't you, change your password and let an administrator know.
+`, user.Name, newEmail),
+	})
+	if err != nil {
+		slog.Error("failed to send email change notice", "user_id", user.ID, "error", err)
+	}
+	return nil
+}
+
+// ConfirmEmailChange applies a pending email change. The password login's
+// identifier is the email, so it is updated too.
+func (s *AuthService) ConfirmEmailChange(ctx context.Context, token string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.ConfirmEmailChange")
+	defer span.End()
+
+	user, err := s.app.Repos.EmailChanges.Confirm(ctx, HashToken(token))
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrInvalidEmailChange
+	case errors.Is(err, repository.ErrConflict):
+		return nil, ErrEmailTaken
+	case err != nil:
+		return nil, err
+	}
+	return user, nil
+}
+
+// Linked logins
+
+// OAuthProvider returns a configured provider by name
+func (s *AuthService) OAuthProvider(name string) (*oauth.Provider, bool) {
+	provider, ok := s.app.OAuth[name]
+	return provider, ok
+}
+
+// OAuthProviderNames lists the configured providers in a stable order
+func (s *AuthService) OAuthProviderNames() []string {
+	names := make([]string, 0, len(s.app.OAuth))
+	for name := range s.app.OAuth {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *AuthService) GetUserLogins(ctx context.Context, userID int) ([]models.Login, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetUserLogins")
+	defer span.End()
+	return s.app.Repos.Logins.ListForUser(ctx, userID)
+}
+
+// LinkLogin attaches a provider account to the user. Linking the same account
+// twice is a no-op; linking one that belongs to someone else fails.
+func (s *AuthService) LinkLogin(ctx context.Context, userID int, provider, providerID string) (*models.Login, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.LinkLogin")
+	defer span.End()
+
+	login, err := s.app.Repos.Logins.Link(ctx, userID, provider, providerID)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, ErrLoginAlreadyLinked
+	}
+	return login, err
+}
+
+// UnlinkLogin removes a linked provider login. The password login cannot be
+// removed here, and the user must keep at least one login.
+func (s *AuthService) UnlinkLogin(ctx context.Context, userID, loginID int) error {
+	ctx, span := tracing.Start(ctx, "AuthService.UnlinkLogin")
+	defer span.End()
+
+	count, err := s.app.Repos.Logins.CountForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if count <= 1 {
+		return ErrLastLogin
+	}
+
+	return s.app.Repos.Logins.Delete(ctx, userID, loginID)
+}
+
+// AuthenticateOAuth signs in with a linked provider account. It applies the
+// same IP throttling and lockout checks as password sign-in.
+func (s *AuthService) AuthenticateOAuth(ctx context.Context, provider, providerID, ipAddress string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.AuthenticateOAuth")
+	defer span.End()
+
+	user, err := s.authenticateOAuth(ctx, provider, providerID, ipAddress)
+	countLogin(provider, err)
+	return user, err
+}
+
+func (s *AuthService) authenticateOAuth(ctx context.Context, provider, providerID, ipAddress string) (*models.User, error) {
+	blocked, err := s.isIPThrottled(ctx, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrTooManyAttempts
+	}
+
+	user, err := s.app.Repos.Users.GetByLogin(ctx, provider, providerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			s.recordLoginAttempt(ctx, provider+":"+providerID, ipAddress, false)
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if user.IsLocked() {
+		s.recordLoginAttempt(ctx, user.Email, ipAddress, false)
+		return nil, ErrTooManyAttempts
+	}
+	if user.IsDeactivated() {
+		s.recordLoginAttempt(ctx, user.Email, ipAddress, false)
+		return nil, ErrAccountDeactivated
+	}
+
+	s.recordLoginAttempt(ctx, user.Email, ipAddress, true)
+	if err := s.UnlockUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Account
+
+func (s *UserService) UpdateName(ctx context.Context, id int, name string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateName")
+	defer span.End()
+	return s.app.Repos.Users.UpdateName(ctx, id, name)
+}
+
+// DeleteAccount deletes a user's own account. Their posts are kept without an
+// author. The last admin cannot delete themselves.
+func (s *UserService) DeleteAccount(ctx context.Context, user *models.User) error {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteAccount")
+	defer span.End()
+	return s.DeleteUser(ctx, user.ID, 0)
+}
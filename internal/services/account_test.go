@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/models"
+)
+
+// TestVerifyPasswordLocksOut checks that guessing the current password from
+// a signed-in session locks the account just as failed sign-ins do
+func TestVerifyPasswordLocksOut(t *testing.T) {
+	ctx := context.Background()
+	a := newTestApp(t)
+	auth := NewAuthService(a)
+	user := createTestUser(t, a, "author@example.com", models.RoleAuthor)
+	const password = "violet tractor lantern"
+	if _, err := auth.CreatePasswordLogin(ctx, user.ID, user.Email, password); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < LockoutThreshold; i++ {
+		if err := auth.VerifyPassword(ctx, user, "wrong guess", "192.0.2.1"); err != ErrInvalidCredentials {
+			t.Fatalf("guess %d: got %v, want ErrInvalidCredentials", i+1, err)
+		}
+	}
+
+	locked, err := a.Repos.Users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked.IsLocked() {
+		t.Fatal("account is not locked after repeated failures")
+	}
+	if err := auth.VerifyPassword(ctx, locked, password, "192.0.2.1"); err != ErrTooManyAttempts {
+		t.Errorf("correct password while locked: got %v, want ErrTooManyAttempts", err)
+	}
+}
+
+// TestEmailChangeReplaceRollsBack fails the insert of a new request, which
+// must leave the earlier one confirmable
+func TestEmailChangeReplaceRollsBack(t *testing.T) {
+	ctx := context.Background()
+	a := newTestApp(t)
+	user := createTestUser(t, a, "author@example.com", models.RoleAuthor)
+	expiresAt := time.Now().Add(EmailChangeDuration)
+	if err := a.Repos.EmailChanges.Replace(ctx, user.ID, "first@example.com", HashToken("first"), expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	failStatement(t, a, "INSERT", "email_changes")
+
+	if err := a.Repos.EmailChanges.Replace(ctx, user.ID, "second@example.com", HashToken("second"), expiresAt); err == nil {
+		t.Fatal("Replace succeeded, want the injected failure")
+	}
+
+	confirmed, err := NewAuthService(a).ConfirmEmailChange(ctx, "first")
+	if err != nil {
+		t.Fatalf("confirming the earlier request: %v", err)
+	}
+	if confirmed.Email != "first@example.com" {
+		t.Errorf("email = %q, want first@example.com", confirmed.Email)
+	}
+}
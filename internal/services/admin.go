@@ -1,15 +1,20 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"time"
 	"unicode"
 
 	"github.com/ioverpi/personal-site/internal/app"
 	"github.com/ioverpi/personal-site/internal/models"
-	"github.com/lib/pq"
+	"github.com/ioverpi/personal-site/internal/repository"
+	"github.com/ioverpi/personal-site/internal/tracing"
 )
 
+var ErrSlugTaken = errors.New("slug is already in use")
+
 type AdminService struct {
 	app *app.App
 }
@@ -21,83 +26,105 @@ func NewAdminService(app *app.App) *AdminService {
 // Posts
 
 type CreatePostInput struct {
-	Title   string
-	Slug    string
-	Content string
-	Publish bool
+	Title       string
+	Slug        string
+	Content     string
+	Publish     bool
+	ScheduledAt *time.Time // Publish time for a draft; ignored when Publish is set
+	AuthorID    int
 }
 
 type UpdatePostInput struct {
-	Title   string
-	Slug    string
-	Content string
-	Publish bool
+	Title       string
+	Slug        string
+	Content     string
+	Publish     bool
+	ScheduledAt *time.Time // Publish time for a draft; ignored when Publish is set
 }
 
-func (s *AdminService) CreatePost(input CreatePostInput) (*models.Post, error) {
+func (s *AdminService) CreatePost(ctx context.Context, input CreatePostInput) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.CreatePost")
+	defer span.End()
+
 	slug := input.Slug
 	if slug == "" {
 		slug = generateSlug(input.Title)
 	}
 
-	var publishedAt *time.Time
+	post := &models.Post{
+		Title:    input.Title,
+		Slug:     slug,
+		Content:  input.Content,
+		AuthorID: &input.AuthorID,
+	}
 	if input.Publish {
 		now := time.Now()
-		publishedAt = &now
-	}
-
-	var post models.Post
-	err := s.app.DB.QueryRow(`
-		INSERT INTO posts (title, slug, content, published_at, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, NOW(), NOW())
-		RETURNING id, title, slug, content, published_at, created_at, updated_at
-	`, input.Title, slug, input.Content, publishedAt).Scan(
-		&post.ID, &post.Title, &post.Slug, &post.Content,
-		&post.PublishedAt, &post.CreatedAt, &post.UpdatedAt,
-	)
-	if err != nil {
+		post.PublishedAt = &now
+	} else {
+		post.ScheduledAt = input.ScheduledAt
+	}
+
+	if err := s.app.Repos.Posts.Create(ctx, post); err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return nil, ErrSlugTaken
+		}
 		return nil, err
 	}
-	return &post, nil
+	return post, nil
 }
 
-func (s *AdminService) UpdatePost(id int, input UpdatePostInput) (*models.Post, error) {
+func (s *AdminService) UpdatePost(ctx context.Context, id int, input UpdatePostInput) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.UpdatePost")
+	defer span.End()
+
+	slug := input.Slug
+	if slug == "" {
+		slug = generateSlug(input.Title)
+	}
+
 	// Get current post to check publish status
-	var currentPublishedAt *time.Time
-	err := s.app.DB.QueryRow(`SELECT published_at FROM posts WHERE id = $1`, id).Scan(&currentPublishedAt)
+	post, err := s.app.Repos.Posts.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	var publishedAt *time.Time
+	post.Title = input.Title
+	post.Slug = slug
+	post.Content = input.Content
+	post.ScheduledAt = nil
 	if input.Publish {
-		if currentPublishedAt != nil {
-			publishedAt = currentPublishedAt // Keep original publish date
-		} else {
+		// Keep the original publish date if there is one
+		if post.PublishedAt == nil {
 			now := time.Now()
-			publishedAt = &now
+			post.PublishedAt = &now
 		}
+	} else {
+		post.PublishedAt = nil
+		post.ScheduledAt = input.ScheduledAt
 	}
 
-	var post models.Post
-	err = s.app.DB.QueryRow(`
-		UPDATE posts
-		SET title = $1, slug = $2, content = $3, published_at = $4, updated_at = NOW()
-		WHERE id = $5
-		RETURNING id, title, slug, content, published_at, created_at, updated_at
-	`, input.Title, input.Slug, input.Content, publishedAt, id).Scan(
-		&post.ID, &post.Title, &post.Slug, &post.Content,
-		&post.PublishedAt, &post.CreatedAt, &post.UpdatedAt,
-	)
-	if err != nil {
+	if err := s.app.Repos.Posts.Update(ctx, post); err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return nil, ErrSlugTaken
+		}
 		return nil, err
 	}
-	return &post, nil
+	return post, nil
 }
 
-func (s *AdminService) DeletePost(id int) error {
-	_, err := s.app.DB.Exec(`DELETE FROM posts WHERE id = $1`, id)
-	return err
+func (s *AdminService) DeletePost(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "AdminService.DeletePost")
+	defer span.End()
+	return s.app.Repos.Posts.Delete(ctx, id)
+}
+
+// PublishScheduledPosts publishes drafts whose scheduled time has passed,
+// dated at the time they were scheduled for. It returns how many were
+// published.
+func (s *AdminService) PublishScheduledPosts(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.PublishScheduledPosts")
+	defer span.End()
+	return s.app.Repos.Posts.PublishScheduled(ctx)
 }
 
 // Projects
@@ -120,60 +147,50 @@ type UpdateProjectInput struct {
 	DisplayOrder int
 }
 
-func (s *AdminService) CreateProject(input CreateProjectInput) (*models.Project, error) {
-	var githubURL, demoURL *string
-	if input.GithubURL != "" {
-		githubURL = &input.GithubURL
-	}
-	if input.DemoURL != "" {
-		demoURL = &input.DemoURL
-	}
+func (s *AdminService) CreateProject(ctx context.Context, input CreateProjectInput) (*models.Project, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.CreateProject")
+	defer span.End()
 
-	var project models.Project
-	err := s.app.DB.QueryRow(`
-		INSERT INTO projects (name, description, tags, github_url, demo_url, display_order, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, NOW())
-		RETURNING id, name, description, tags, github_url, demo_url, display_order, created_at
-	`, input.Name, input.Description, pq.Array(input.Tags), githubURL, demoURL, input.DisplayOrder).Scan(
-		&project.ID, &project.Name, &project.Description,
-		pq.Array(&project.Tags), &project.GithubURL, &project.DemoURL,
-		&project.DisplayOrder, &project.CreatedAt,
-	)
-	if err != nil {
+	project := newProject(input.Name, input.Description, input.Tags, input.GithubURL, input.DemoURL, input.DisplayOrder)
+	if err := s.app.Repos.Projects.Create(ctx, project); err != nil {
 		return nil, err
 	}
-	return &project, nil
+	return project, nil
 }
 
-func (s *AdminService) UpdateProject(id int, input UpdateProjectInput) (*models.Project, error) {
-	var githubURL, demoURL *string
-	if input.GithubURL != "" {
-		githubURL = &input.GithubURL
-	}
-	if input.DemoURL != "" {
-		demoURL = &input.DemoURL
-	}
+func (s *AdminService) UpdateProject(ctx context.Context, id int, input UpdateProjectInput) (*models.Project, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.UpdateProject")
+	defer span.End()
 
-	var project models.Project
-	err := s.app.DB.QueryRow(`
-		UPDATE projects
-		SET name = $1, description = $2, tags = $3, github_url = $4, demo_url = $5, display_order = $6
-		WHERE id = $7
-		RETURNING id, name, description, tags, github_url, demo_url, display_order, created_at
-	`, input.Name, input.Description, pq.Array(input.Tags), githubURL, demoURL, input.DisplayOrder, id).Scan(
-		&project.ID, &project.Name, &project.Description,
-		pq.Array(&project.Tags), &project.GithubURL, &project.DemoURL,
-		&project.DisplayOrder, &project.CreatedAt,
-	)
-	if err != nil {
+	project := newProject(input.Name, input.Description, input.Tags, input.GithubURL, input.DemoURL, input.DisplayOrder)
+	project.ID = id
+	if err := s.app.Repos.Projects.Update(ctx, project); err != nil {
 		return nil, err
 	}
-	return &project, nil
+	return project, nil
 }
 
-func (s *AdminService) DeleteProject(id int) error {
-	_, err := s.app.DB.Exec(`DELETE FROM projects WHERE id = $1`, id)
-	return err
+func (s *AdminService) DeleteProject(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "AdminService.DeleteProject")
+	defer span.End()
+	return s.app.Repos.Projects.Delete(ctx, id)
+}
+
+// newProject builds a project from form values, storing empty URLs as NULL
+func newProject(name, description string, tags []string, githubURL, demoURL string, displayOrder int) *models.Project {
+	project := &models.Project{
+		Name:         name,
+		Description:  description,
+		Tags:         tags,
+		DisplayOrder: displayOrder,
+	}
+	if githubURL != "" {
+		project.GithubURL = &githubURL
+	}
+	if demoURL != "" {
+		project.DemoURL = &demoURL
+	}
+	return project
 }
 
 // Quotes
@@ -190,40 +207,32 @@ type UpdateQuoteInput struct {
 	IsOwn   bool
 }
 
-func (s *AdminService) CreateQuote(input CreateQuoteInput) (*models.Quote, error) {
-	var quote models.Quote
-	err := s.app.DB.QueryRow(`
-		INSERT INTO quotes (content, author, is_own, created_at)
-		VALUES ($1, $2, $3, NOW())
-		RETURNING id, content, author, is_own, created_at
-	`, input.Content, input.Author, input.IsOwn).Scan(
-		&quote.ID, &quote.Content, &quote.Author, &quote.IsOwn, &quote.CreatedAt,
-	)
-	if err != nil {
+func (s *AdminService) CreateQuote(ctx context.Context, input CreateQuoteInput) (*models.Quote, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.CreateQuote")
+	defer span.End()
+
+	quote := &models.Quote{Content: input.Content, Author: input.Author, IsOwn: input.IsOwn}
+	if err := s.app.Repos.Quotes.Create(ctx, quote); err != nil {
 		return nil, err
 	}
-	return &quote, nil
+	return quote, nil
 }
 
-func (s *AdminService) UpdateQuote(id int, input UpdateQuoteInput) (*models.Quote, error) {
-	var quote models.Quote
-	err := s.app.DB.QueryRow(`
-		UPDATE quotes
-		SET content = $1, author = $2, is_own = $3
-		WHERE id = $4
-		RETURNING id, content, author, is_own, created_at
-	`, input.Content, input.Author, input.IsOwn, id).Scan(
-		&quote.ID, &quote.Content, &quote.Author, &quote.IsOwn, &quote.CreatedAt,
-	)
-	if err != nil {
+func (s *AdminService) UpdateQuote(ctx context.Context, id int, input UpdateQuoteInput) (*models.Quote, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.UpdateQuote")
+	defer span.End()
+
+	quote := &models.Quote{ID: id, Content: input.Content, Author: input.Author, IsOwn: input.IsOwn}
+	if err := s.app.Repos.Quotes.Update(ctx, quote); err != nil {
 		return nil, err
 	}
-	return &quote, nil
+	return quote, nil
 }
 
-func (s *AdminService) DeleteQuote(id int) error {
-	_, err := s.app.DB.Exec(`DELETE FROM quotes WHERE id = $1`, id)
-	return err
+func (s *AdminService) DeleteQuote(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "AdminService.DeleteQuote")
+	defer span.End()
+	return s.app.Repos.Quotes.Delete(ctx, id)
 }
 
 // Helper functions
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ioverpi/personal-site/internal/app"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/repository"
+	"github.com/ioverpi/personal-site/internal/tracing"
+)
+
+type AuditService struct {
+	app *app.App
+}
+
+func NewAuditService(app *app.App) *AuditService {
+	return &AuditService{app: app}
+}
+
+// AuditEntry describes an event to record. Before and After are marshalled to
+// JSON; leave them nil when there is no snapshot.
+type AuditEntry struct {
+	ActorID    int
+	ActorEmail string // Used when the actor no longer exists, e.g. self-deletion
+	// ImpersonatorEmail is set when an admin acted while viewing as the actor
+	ImpersonatorEmail string
+	Action            string
+	TargetType        string
+	TargetID          int
+	Before            any
+	After             any
+	RequestID         string
+	IPAddress         string
+}
+
+// Record stores an audit event. The actor's email is copied onto the event so
+// it stays readable after the account is deleted, and an actor who has
+// already been deleted is recorded by email alone. The event is stored even
+// if ctx is cancelled, since the change it describes has already been made.
+func (s *AuditService) Record(ctx context.Context, entry AuditEntry) error {
+	ctx, span := tracing.Start(ctx, "AuditService.Record")
+	defer span.End()
+
+	ctx = context.WithoutCancel(ctx)
+	before, err := auditSnapshot(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := auditSnapshot(entry.After)
+	if err != nil {
+		return err
+	}
+
+	var actorID, targetID *int
+	if entry.ActorID != 0 {
+		actorID = &entry.ActorID
+	}
+	if entry.TargetID != 0 {
+		targetID = &entry.TargetID
+	}
+	var impersonator *string
+	if entry.ImpersonatorEmail != "" {
+		impersonator = &entry.ImpersonatorEmail
+	}
+
+	return s.app.Repos.AuditEvents.Record(ctx, &models.AuditEvent{
+		ActorID:           actorID,
+		ActorEmail:        entry.ActorEmail,
+		ImpersonatorEmail: impersonator,
+		Action:            entry.Action,
+		TargetType:        entry.TargetType,
+		TargetID:          targetID,
+		Before:            before,
+		After:             after,
+		RequestID:         entry.RequestID,
+		IPAddress:         entry.IPAddress,
+	})
+}
+
+// AuditFilter narrows GetEvents. Zero values match everything; Limit 0 means
+// no limit.
+type AuditFilter = repository.AuditFilter
+
+// GetEvents returns matching events, newest first
+func (s *AuditService) GetEvents(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.GetEvents")
+	defer span.End()
+	return s.app.Repos.AuditEvents.List(ctx, filter)
+}
+
+// ExportEvents calls fn with each matching event, newest first, without
+// loading them all at once
+func (s *AuditService) ExportEvents(ctx context.Context, filter AuditFilter, fn func(event *models.AuditEvent) error) error {
+	ctx, span := tracing.Start(ctx, "AuditService.ExportEvents")
+	defer span.End()
+	return s.app.Repos.AuditEvents.Each(ctx, filter, fn)
+}
+
+// auditSnapshot marshals v to JSON, or returns nil when there is no snapshot
+func auditSnapshot(v any) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
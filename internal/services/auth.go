@@ -1,14 +1,21 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"log/slog"
 	"time"
 
+	"github.com/ioverpi/personal-site/internal/adapters/mail"
 	"github.com/ioverpi/personal-site/internal/app"
+	"github.com/ioverpi/personal-site/internal/metrics"
 	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/tracing"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -17,14 +24,18 @@ var (
 	ErrInvalidSession     = errors.New("invalid or expired session")
 	ErrInvalidInvite      = errors.New("invalid or expired invite")
 	ErrInviteAlreadyUsed  = errors.New("invite already used")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrTooManyAttempts    = errors.New("too many failed login attempts")
+	ErrAccountDeactivated = errors.New("account is deactivated")
 )
 
 type AuthService struct {
-	app *app.App
+	app       *app.App
+	passwords *PasswordPolicy
 }
 
 func NewAuthService(app *app.App) *AuthService {
-	return &AuthService{app: app}
+	return &AuthService{app: app, passwords: NewPasswordPolicy(app)}
 }
 
 // Password hashing
@@ -49,279 +60,387 @@ func GenerateToken() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+// HashToken returns the SHA-256 of a token as hex. Only this hash is stored,
+// so a leaked database does not contain usable session or invite tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // Login methods
 
-func (s *AuthService) GetLoginByEmail(email string) (*models.Login, error) {
-	var login models.Login
-	err := s.app.DB.QueryRow(`
-		SELECT id, user_id, provider, provider_id, password_hash, created_at, updated_at
-		FROM logins
-		WHERE provider = $1 AND provider_id = $2
-	`, models.ProviderPassword, email).Scan(
-		&login.ID, &login.UserID, &login.Provider, &login.ProviderID,
-		&login.PasswordHash, &login.CreatedAt, &login.UpdatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return &login, nil
+func (s *AuthService) GetLoginByEmail(ctx context.Context, email string) (*models.Login, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetLoginByEmail")
+	defer span.End()
+	return s.app.Repos.Logins.GetByProvider(ctx, models.ProviderPassword, email)
 }
 
-func (s *AuthService) CreatePasswordLogin(userID int, email, password string) (*models.Login, error) {
+func (s *AuthService) CreatePasswordLogin(ctx context.Context, userID int, email, password string) (*models.Login, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.CreatePasswordLogin")
+	defer span.End()
+
 	hash, err := HashPassword(password)
 	if err != nil {
 		return nil, err
 	}
 
-	var login models.Login
-	err = s.app.DB.QueryRow(`
-		INSERT INTO logins (user_id, provider, provider_id, password_hash)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, user_id, provider, provider_id, password_hash, created_at, updated_at
-	`, userID, models.ProviderPassword, email, hash).Scan(
-		&login.ID, &login.UserID, &login.Provider, &login.ProviderID,
-		&login.PasswordHash, &login.CreatedAt, &login.UpdatedAt,
-	)
-	if err != nil {
+	login := newPasswordLogin(userID, email, hash)
+	if err := s.app.Repos.Logins.Create(ctx, login); err != nil {
 		return nil, err
 	}
-	return &login, nil
+	return login, nil
 }
 
-func (s *AuthService) UpdatePassword(userID int, newPassword string) error {
+// newPasswordLogin is a login for signing in with email and password. The
+// email is the login's identifier.
+func newPasswordLogin(userID int, email, hash string) *models.Login {
+	return &models.Login{
+		UserID:       userID,
+		Provider:     models.ProviderPassword,
+		ProviderID:   email,
+		PasswordHash: &hash,
+	}
+}
+
+func (s *AuthService) UpdatePassword(ctx context.Context, userID int, newPassword string) error {
+	ctx, span := tracing.Start(ctx, "AuthService.UpdatePassword")
+	defer span.End()
+
 	hash, err := HashPassword(newPassword)
 	if err != nil {
 		return err
 	}
-
-	_, err = s.app.DB.Exec(`
-		UPDATE logins
-		SET password_hash = $1, updated_at = NOW()
-		WHERE user_id = $2 AND provider = $3
-	`, hash, userID, models.ProviderPassword)
-	return err
+	return s.app.Repos.Logins.SetPasswordHash(ctx, userID, hash)
 }
 
 // Authentication
 
-func (s *AuthService) Authenticate(email, password string) (*models.User, error) {
-	login, err := s.GetLoginByEmail(email)
+// Authenticate checks an email and password. Failed attempts are recorded per
+// account and per IP; repeated failures lock the account with exponential
+// backoff, and an IP with too many recent failures is refused outright.
+func (s *AuthService) Authenticate(ctx context.Context, email, password, ipAddress string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Authenticate")
+	defer span.End()
+
+	user, err := s.authenticate(ctx, email, password, ipAddress)
+	countLogin(models.ProviderPassword, err)
+	return user, err
+}
+
+func (s *AuthService) authenticate(ctx context.Context, email, password, ipAddress string) (*models.User, error) {
+	blocked, err := s.isIPThrottled(ctx, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		s.recordLoginAttempt(ctx, email, ipAddress, false)
+		return nil, ErrTooManyAttempts
+	}
+
+	login, err := s.GetLoginByEmail(ctx, email)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			s.recordLoginAttempt(ctx, email, ipAddress, false)
 			return nil, ErrInvalidCredentials
 		}
 		return nil, err
 	}
 
+	user, err := s.app.Repos.Users.GetByID(ctx, login.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A locked account is refused without checking the password, so guessing
+	// cannot continue during the lockout
+	if user.IsLocked() {
+		s.recordLoginAttempt(ctx, email, ipAddress, false)
+		return nil, ErrTooManyAttempts
+	}
+
 	if login.PasswordHash == nil || !CheckPassword(password, *login.PasswordHash) {
+		s.recordLoginAttempt(ctx, email, ipAddress, false)
+		if err := s.recordAccountFailure(ctx, user, ipAddress); err != nil {
+			return nil, err
+		}
 		return nil, ErrInvalidCredentials
 	}
 
-	var user models.User
-	err = s.app.DB.QueryRow(`
-		SELECT id, email, name, role, created_at, updated_at
-		FROM users
-		WHERE id = $1
-	`, login.UserID).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Role,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
-	if err != nil {
+	// Checked only after the password, so it doesn't reveal which accounts exist
+	if user.IsDeactivated() {
+		s.recordLoginAttempt(ctx, email, ipAddress, false)
+		return nil, ErrAccountDeactivated
+	}
+
+	s.recordLoginAttempt(ctx, email, ipAddress, true)
+	if err := s.UnlockUser(ctx, user.ID); err != nil {
 		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
 }
 
-// Sessions
+// Login throttling
 
-func (s *AuthService) CreateSession(userID int, duration time.Duration) (*models.Session, error) {
-	token, err := GenerateToken()
-	if err != nil {
-		return nil, err
-	}
+const (
+	// LockoutThreshold is the number of consecutive failures that locks an account
+	LockoutThreshold = 5
 
-	expiresAt := time.Now().Add(duration)
+	// The first lockout lasts lockoutBase; each further failure doubles it
+	lockoutBase = time.Minute
+	lockoutMax  = 24 * time.Hour
 
-	var session models.Session
-	err = s.app.DB.QueryRow(`
-		INSERT INTO sessions (user_id, token, expires_at)
-		VALUES ($1, $2, $3)
-		RETURNING id, user_id, token, expires_at, created_at
-	`, userID, token, expiresAt).Scan(
-		&session.ID, &session.UserID, &session.Token,
-		&session.ExpiresAt, &session.CreatedAt,
-	)
-	if err != nil {
-		return nil, err
+	// An IP with ipFailureLimit failures within ipFailureWindow is refused
+	ipFailureLimit  = 20
+	ipFailureWindow = 15 * time.Minute
+)
+
+// lockoutDuration returns how long to lock an account after the given number
+// of consecutive failures.
+func lockoutDuration(failures int) time.Duration {
+	doublings := failures - LockoutThreshold
+	if doublings < 0 {
+		return 0
+	}
+	if doublings > 20 {
+		return lockoutMax
 	}
-	return &session, nil
+	return min(lockoutBase<<doublings, lockoutMax)
 }
 
-func (s *AuthService) GetSession(token string) (*models.Session, error) {
-	var session models.Session
-	err := s.app.DB.QueryRow(`
-		SELECT id, user_id, token, expires_at, created_at
-		FROM sessions
-		WHERE token = $1
-	`, token).Scan(
-		&session.ID, &session.UserID, &session.Token,
-		&session.ExpiresAt, &session.CreatedAt,
-	)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrInvalidSession
-		}
-		return nil, err
+// countLogin adds a sign-in attempt to the logins metric, by what err says
+// about why it failed
+func countLogin(method string, err error) {
+	result := "success"
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrInvalidLoginLink):
+		result = "invalid"
+	case errors.Is(err, ErrTooManyAttempts):
+		result = "throttled"
+	case errors.Is(err, ErrAccountDeactivated):
+		result = "deactivated"
+	default:
+		result = "error"
 	}
+	metrics.Logins.WithLabelValues(method, result).Inc()
+}
 
-	if session.IsExpired() {
-		s.DeleteSession(token)
-		return nil, ErrInvalidSession
+// recordLoginAttempt stores the attempt for the per-IP throttle. It isn't
+// cancelled with ctx, so a client can't dodge the throttle by disconnecting.
+func (s *AuthService) recordLoginAttempt(ctx context.Context, email, ipAddress string, succeeded bool) {
+	ctx = context.WithoutCancel(ctx)
+	if err := s.app.Repos.LoginAttempts.Record(ctx, email, ipAddress, succeeded); err != nil {
+		slog.Error("failed to record login attempt", "error", err)
 	}
-
-	return &session, nil
 }
 
-func (s *AuthService) GetUserBySession(token string) (*models.User, error) {
-	session, err := s.GetSession(token)
+func (s *AuthService) isIPThrottled(ctx context.Context, ipAddress string) (bool, error) {
+	failures, err := s.app.Repos.LoginAttempts.CountFailures(ctx, ipAddress, time.Now().Add(-ipFailureWindow))
 	if err != nil {
-		return nil, err
+		return false, err
 	}
+	return failures >= ipFailureLimit, nil
+}
 
-	var user models.User
-	err = s.app.DB.QueryRow(`
-		SELECT id, email, name, role, created_at, updated_at
-		FROM users
-		WHERE id = $1
-	`, session.UserID).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Role,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
+// recordAccountFailure bumps the user's failure count and locks the account
+// once LockoutThreshold is reached. The owner is emailed on the first lock.
+// Like recordLoginAttempt, it carries on if the client disconnects.
+func (s *AuthService) recordAccountFailure(ctx context.Context, user *models.User, ipAddress string) error {
+	ctx = context.WithoutCancel(ctx)
+	failures, err := s.app.Repos.Users.RecordLoginFailure(ctx, user.ID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &user, nil
+	if failures < LockoutThreshold {
+		return nil
+	}
+
+	lockedUntil := time.Now().Add(lockoutDuration(failures))
+	if err := s.app.Repos.Users.Lock(ctx, user.ID, lockedUntil); err != nil {
+		return err
+	}
+
+	if failures == LockoutThreshold {
+		go s.sendLockoutNotice(user, ipAddress, lockedUntil)
+	}
+	return nil
 }
 
-func (s *AuthService) DeleteSession(token string) error {
-	_, err := s.app.DB.Exec(`DELETE FROM sessions WHERE token = $1`, token)
-	return err
+func (s *AuthService) sendLockoutNotice(user *models.User, ipAddress string, lockedUntil time.Time) {
+	body := fmt.Sprintf(`Hi %s,
+
+Your account was temporarily locked after %d failed sign-in attempts.
+The most recent attempt came from %s.
+
+You can try again after %s. If this wasn't you, consider changing your
+password once you're back in, and let an administrator know.
+`, user.Name, LockoutThreshold, ipAddress, lockedUntil.Format("Jan 2, 2006 3:04 PM MST"))
+
+	err := s.app.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your account has been temporarily locked",
+		Body:    body,
+	})
+	if err != nil {
+		slog.Error("failed to send lockout notice", "user_id", user.ID, "error", err)
+	}
 }
 
-func (s *AuthService) DeleteUserSessions(userID int) error {
-	_, err := s.app.DB.Exec(`DELETE FROM sessions WHERE user_id = $1`, userID)
-	return err
+// UnlockUser clears an account's failure count and any active lockout
+func (s *AuthService) UnlockUser(ctx context.Context, userID int) error {
+	ctx, span := tracing.Start(ctx, "AuthService.UnlockUser")
+	defer span.End()
+	return s.app.Repos.Users.Unlock(ctx, userID)
 }
 
-func (s *AuthService) CleanExpiredSessions() error {
-	_, err := s.app.DB.Exec(`DELETE FROM sessions WHERE expires_at < NOW()`)
-	return err
+// CleanLoginAttempts removes login attempts older than retention. Attempts
+// inside the IP throttling window are always kept.
+func (s *AuthService) CleanLoginAttempts(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.CleanLoginAttempts")
+	defer span.End()
+	retention = max(retention, ipFailureWindow)
+	return s.app.Repos.LoginAttempts.DeleteBefore(ctx, time.Now().Add(-retention))
 }
 
-// Invites
+// Sessions
+
+// SessionTouchInterval is how often a session's last-seen time is refreshed.
+const SessionTouchInterval = time.Minute
+
+func (s *AuthService) CreateSession(ctx context.Context, userID int, duration time.Duration, userAgent, ipAddress string) (*models.Session, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.CreateSession")
+	defer span.End()
 
-func (s *AuthService) CreateInvite(email string, invitedBy int, duration time.Duration) (*models.Invite, error) {
 	token, err := GenerateToken()
 	if err != nil {
 		return nil, err
 	}
 
-	expiresAt := time.Now().Add(duration)
-
-	var invite models.Invite
-	err = s.app.DB.QueryRow(`
-		INSERT INTO invites (email, token, invited_by, expires_at)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, email, token, invited_by, used_at, expires_at, created_at
-	`, email, token, invitedBy, expiresAt).Scan(
-		&invite.ID, &invite.Email, &invite.Token, &invite.InvitedBy,
-		&invite.UsedAt, &invite.ExpiresAt, &invite.CreatedAt,
-	)
-	if err != nil {
+	session := &models.Session{
+		UserID:    userID,
+		TokenHash: HashToken(token),
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+		ExpiresAt: time.Now().Add(duration),
+	}
+	if err := s.app.Repos.Sessions.Create(ctx, session); err != nil {
 		return nil, err
 	}
-	return &invite, nil
+
+	// The plaintext token is only available here, for the caller to set as a cookie
+	session.Token = token
+	return session, nil
 }
 
-func (s *AuthService) GetInvite(token string) (*models.Invite, error) {
-	var invite models.Invite
-	err := s.app.DB.QueryRow(`
-		SELECT id, email, token, invited_by, used_at, expires_at, created_at
-		FROM invites
-		WHERE token = $1
-	`, token).Scan(
-		&invite.ID, &invite.Email, &invite.Token, &invite.InvitedBy,
-		&invite.UsedAt, &invite.ExpiresAt, &invite.CreatedAt,
-	)
+func (s *AuthService) GetSession(ctx context.Context, token string) (*models.Session, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetSession")
+	defer span.End()
+
+	// Looking up by hash keeps the comparison from leaking the token through
+	// timing: the database compares hashes, not the token itself
+	session, err := s.app.Repos.Sessions.GetByTokenHash(ctx, HashToken(token))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, ErrInvalidInvite
+			return nil, ErrInvalidSession
 		}
 		return nil, err
 	}
 
-	if invite.IsExpired() {
-		return nil, ErrInvalidInvite
-	}
-
-	if invite.IsUsed() {
-		return nil, ErrInviteAlreadyUsed
+	if session.IsExpired() {
+		s.DeleteSession(ctx, token)
+		return nil, ErrInvalidSession
 	}
 
-	return &invite, nil
+	return session, nil
 }
 
-func (s *AuthService) UseInvite(token string) error {
-	result, err := s.app.DB.Exec(`
-		UPDATE invites
-		SET used_at = NOW()
-		WHERE token = $1 AND used_at IS NULL AND expires_at > NOW()
-	`, token)
+// ValidateSession returns the session for a token along with its user.
+func (s *AuthService) ValidateSession(ctx context.Context, token string) (*models.Session, *models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.ValidateSession")
+	defer span.End()
+
+	session, err := s.GetSession(ctx, token)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	rows, err := result.RowsAffected()
+	user, err := s.app.Repos.Users.GetByID(ctx, session.UserID)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	if rows == 0 {
-		return ErrInvalidInvite
+
+	if user.IsDeactivated() {
+		return nil, nil, ErrInvalidSession
 	}
 
-	return nil
+	return session, user, nil
 }
 
-func (s *AuthService) GetPendingInvites() ([]models.Invite, error) {
-	rows, err := s.app.DB.Query(`
-		SELECT id, email, token, invited_by, used_at, expires_at, created_at
-		FROM invites
-		WHERE used_at IS NULL AND expires_at > NOW()
-		ORDER BY created_at DESC
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+func (s *AuthService) GetUserBySession(ctx context.Context, token string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetUserBySession")
+	defer span.End()
 
-	var invites []models.Invite
-	for rows.Next() {
-		var invite models.Invite
-		err := rows.Scan(
-			&invite.ID, &invite.Email, &invite.Token, &invite.InvitedBy,
-			&invite.UsedAt, &invite.ExpiresAt, &invite.CreatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		invites = append(invites, invite)
+	_, user, err := s.ValidateSession(ctx, token)
+	return user, err
+}
+
+// TouchSession records activity on a session. The update is skipped if the
+// session was already seen within SessionTouchInterval.
+func (s *AuthService) TouchSession(ctx context.Context, session *models.Session) error {
+	ctx, span := tracing.Start(ctx, "AuthService.TouchSession")
+	defer span.End()
+
+	if time.Since(session.LastSeenAt) < SessionTouchInterval {
+		return nil
 	}
-	return invites, rows.Err()
+
+	return s.app.Repos.Sessions.Touch(ctx, session.ID)
+}
+
+// GetUserSessions returns a user's unexpired sessions, most recently active
+// first. Impersonation sessions are left out; they belong to the admin.
+func (s *AuthService) GetUserSessions(ctx context.Context, userID int) ([]models.Session, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetUserSessions")
+	defer span.End()
+	return s.app.Repos.Sessions.ListActive(ctx, userID)
 }
 
-func (s *AuthService) DeleteInvite(id int) error {
-	_, err := s.app.DB.Exec(`DELETE FROM invites WHERE id = $1`, id)
+func (s *AuthService) DeleteSession(ctx context.Context, token string) error {
+	ctx, span := tracing.Start(ctx, "AuthService.DeleteSession")
+	defer span.End()
+	return s.app.Repos.Sessions.DeleteByTokenHash(ctx, HashToken(token))
+}
+
+// RevokeSession deletes one of a user's sessions by ID. Sessions belonging to
+// other users are never touched.
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID int) error {
+	ctx, span := tracing.Start(ctx, "AuthService.RevokeSession")
+	defer span.End()
+
+	err := s.app.Repos.Sessions.Delete(ctx, userID, sessionID)
+	if err == sql.ErrNoRows {
+		return ErrInvalidSession
+	}
 	return err
 }
+
+// RevokeOtherSessions deletes all of a user's sessions except the given one.
+func (s *AuthService) RevokeOtherSessions(ctx context.Context, userID, keepSessionID int) error {
+	ctx, span := tracing.Start(ctx, "AuthService.RevokeOtherSessions")
+	defer span.End()
+	return s.app.Repos.Sessions.DeleteOthers(ctx, userID, keepSessionID)
+}
+
+func (s *AuthService) DeleteUserSessions(ctx context.Context, userID int) error {
+	ctx, span := tracing.Start(ctx, "AuthService.DeleteUserSessions")
+	defer span.End()
+	return s.app.Repos.Sessions.DeleteAll(ctx, userID)
+}
+
+func (s *AuthService) CleanExpiredSessions(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "AuthService.CleanExpiredSessions")
+	defer span.End()
+	return s.app.Repos.Sessions.DeleteExpired(ctx)
+}
@@ -1,11 +1,11 @@
 package services
 
 import (
-	"database/sql"
+	"context"
 
 	"github.com/ioverpi/personal-site/internal/app"
 	"github.com/ioverpi/personal-site/internal/models"
-	"github.com/lib/pq"
+	"github.com/ioverpi/personal-site/internal/tracing"
 )
 
 type BlogService struct {
@@ -16,82 +16,61 @@ func NewBlogService(app *app.App) *BlogService {
 	return &BlogService{app: app}
 }
 
-func (s *BlogService) GetPublishedPosts() ([]models.Post, error) {
-	rows, err := s.app.DB.Query(`
-		SELECT id, title, slug, content, published_at, created_at, updated_at
-		FROM posts
-		WHERE published_at IS NOT NULL
-		ORDER BY published_at DESC
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	return scanPosts(rows)
+func (s *BlogService) GetPublishedPosts(ctx context.Context) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "BlogService.GetPublishedPosts")
+	defer span.End()
+	return s.app.Repos.Posts.ListPublished(ctx)
 }
 
-func (s *BlogService) GetAllPosts() ([]models.Post, error) {
-	rows, err := s.app.DB.Query(`
-		SELECT id, title, slug, content, published_at, created_at, updated_at
-		FROM posts
-		ORDER BY created_at DESC
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+func (s *BlogService) GetPublishedPostsByAuthor(ctx context.Context, authorID int) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "BlogService.GetPublishedPostsByAuthor")
+	defer span.End()
+	return s.app.Repos.Posts.ListPublishedByAuthor(ctx, authorID)
+}
 
-	return scanPosts(rows)
+func (s *BlogService) GetAllPosts(ctx context.Context) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "BlogService.GetAllPosts")
+	defer span.End()
+	return s.app.Repos.Posts.List(ctx)
 }
 
-func (s *BlogService) GetPostBySlug(slug string) (*models.Post, error) {
-	var post models.Post
-	err := s.app.DB.QueryRow(`
-		SELECT id, title, slug, content, published_at, created_at, updated_at
-		FROM posts
-		WHERE slug = $1
-	`, slug).Scan(
-		&post.ID, &post.Title, &post.Slug, &post.Content,
-		&post.PublishedAt, &post.CreatedAt, &post.UpdatedAt,
-	)
+// GetPostsPage returns one page of GetAllPosts and how many posts there are
+// in all. A page past the last is empty.
+func (s *BlogService) GetPostsPage(ctx context.Context, page, perPage int) ([]models.Post, int, error) {
+	ctx, span := tracing.Start(ctx, "BlogService.GetPostsPage")
+	defer span.End()
+
+	total, err := s.app.Repos.Posts.Count(ctx)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	return &post, nil
+	offset, ok := pageOffset(page, perPage, total)
+	if !ok {
+		return nil, total, nil
+	}
+	posts, err := s.app.Repos.Posts.ListPage(ctx, perPage, offset)
+	return posts, total, err
 }
 
-func (s *BlogService) GetPostByID(id int) (*models.Post, error) {
-	var post models.Post
-	err := s.app.DB.QueryRow(`
-		SELECT id, title, slug, content, published_at, created_at, updated_at
-		FROM posts
-		WHERE id = $1
-	`, id).Scan(
-		&post.ID, &post.Title, &post.Slug, &post.Content,
-		&post.PublishedAt, &post.CreatedAt, &post.UpdatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return &post, nil
+func (s *BlogService) GetPostBySlug(ctx context.Context, slug string) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "BlogService.GetPostBySlug")
+	defer span.End()
+	return s.app.Repos.Posts.GetBySlug(ctx, slug)
 }
 
-func scanPosts(rows *sql.Rows) ([]models.Post, error) {
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		err := rows.Scan(
-			&post.ID, &post.Title, &post.Slug, &post.Content,
-			&post.PublishedAt, &post.CreatedAt, &post.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		posts = append(posts, post)
-	}
-	return posts, rows.Err()
+func (s *BlogService) GetPostByID(ctx context.Context, id int) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "BlogService.GetPostByID")
+	defer span.End()
+	return s.app.Repos.Posts.GetByID(ctx, id)
 }
 
-// Ensure pq is imported for array handling
-var _ = pq.Array
+// pageOffset returns how many items precede the page'th page of perPage
+// items, or false when the page is past the last of total items. Checking
+// against the page count first keeps a huge page number from overflowing
+// the multiplication.
+func pageOffset(page, perPage, total int) (int, bool) {
+	if page < 1 || perPage < 1 || page-1 >= (total+perPage-1)/perPage {
+		return 0, false
+	}
+	return (page - 1) * perPage, true
+}
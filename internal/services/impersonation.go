@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/tracing"
+)
+
+// ImpersonationDuration is how long an admin can view the site as another
+// user before having to start again
+const ImpersonationDuration = time.Hour
+
+var ErrCannotImpersonate = errors.New("user cannot be impersonated")
+
+// StartImpersonation creates a session that signs the admin in as target.
+// Only active, non-admin users can be impersonated, so the session never
+// carries more access than the admin already has.
+func (s *AuthService) StartImpersonation(ctx context.Context, admin, target *models.User, userAgent, ipAddress string) (*models.Session, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.StartImpersonation")
+	defer span.End()
+
+	if !admin.IsAdmin() || admin.ID == target.ID || target.IsAdmin() || target.IsDeactivated() {
+		return nil, ErrCannotImpersonate
+	}
+
+	token, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.Session{
+		UserID:         target.ID,
+		ImpersonatorID: &admin.ID,
+		TokenHash:      HashToken(token),
+		UserAgent:      userAgent,
+		IPAddress:      ipAddress,
+		ExpiresAt:      time.Now().Add(ImpersonationDuration),
+	}
+	if err := s.app.Repos.Sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	session.Token = token
+	return session, nil
+}
+
+// GetImpersonator returns the admin behind an impersonation session. It fails
+// with ErrInvalidSession if they have since lost admin access.
+func (s *AuthService) GetImpersonator(ctx context.Context, session *models.Session) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetImpersonator")
+	defer span.End()
+
+	if !session.IsImpersonation() {
+		return nil, ErrInvalidSession
+	}
+
+	admin, err := s.app.Repos.Users.GetByID(ctx, *session.ImpersonatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !admin.IsAdmin() || admin.IsDeactivated() {
+		return nil, ErrInvalidSession
+	}
+	return admin, nil
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/adapters/mail"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/repository"
+	"github.com/ioverpi/personal-site/internal/tracing"
+)
+
+const (
+	// DefaultInviteDuration is how long an invite is valid unless set otherwise
+	DefaultInviteDuration = 7 * 24 * time.Hour
+	// MaxInviteDuration caps how long an invite can be valid
+	MaxInviteDuration = 90 * 24 * time.Hour
+	// MaxInviteUses caps how many accounts an open invite code can create
+	MaxInviteUses = 100
+)
+
+var (
+	ErrInvalidInviteDuration = errors.New("invalid invite expiry")
+	ErrInvalidInviteUses     = errors.New("invalid number of invite uses")
+	ErrInviteNotResendable   = errors.New("only pending invites addressed to an email can be resent")
+)
+
+type CreateInviteInput struct {
+	Email     string // Empty for an open invite code
+	Role      string
+	MaxUses   int           // Must be 1 when Email is set; 0 means 1
+	Duration  time.Duration // 0 means DefaultInviteDuration
+	InvitedBy int
+}
+
+// CreateInvite creates an invite. An invite addressed to an email is single
+// use; an open invite code can be used up to MaxUses times by anyone with it.
+func (s *AuthService) CreateInvite(ctx context.Context, input CreateInviteInput) (*models.Invite, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.CreateInvite")
+	defer span.End()
+
+	if !models.IsValidRole(input.Role) {
+		return nil, ErrInvalidRole
+	}
+
+	email := strings.TrimSpace(input.Email)
+	if email != "" {
+		if err := ValidateEmail(email); err != nil {
+			return nil, err
+		}
+	}
+
+	maxUses := input.MaxUses
+	if maxUses == 0 {
+		maxUses = 1
+	}
+	if maxUses < 1 || maxUses > MaxInviteUses || (email != "" && maxUses != 1) {
+		return nil, ErrInvalidInviteUses
+	}
+
+	duration := input.Duration
+	if duration == 0 {
+		duration = DefaultInviteDuration
+	}
+	if duration < 0 || duration > MaxInviteDuration {
+		return nil, ErrInvalidInviteDuration
+	}
+
+	token, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	invite := &models.Invite{
+		Email:     email,
+		Role:      input.Role,
+		TokenHash: HashToken(token),
+		InvitedBy: input.InvitedBy,
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(duration),
+	}
+	if err := s.app.Repos.Invites.Create(ctx, invite); err != nil {
+		return nil, err
+	}
+
+	// The plaintext token is only available here, for building the invite link
+	invite.Token = token
+	return invite, nil
+}
+
+// InviteURL is the registration link for an invite token
+func (s *AuthService) InviteURL(token string) string {
+	return s.app.Config.BaseURL + "/register?token=" + url.QueryEscape(token)
+}
+
+// SendInvite emails the registration link for a newly created or reissued
+// invite, which must carry its plaintext token.
+func (s *AuthService) SendInvite(ctx context.Context, invite *models.Invite, inviter *models.User) error {
+	ctx, span := tracing.Start(ctx, "AuthService.SendInvite")
+	defer span.End()
+
+	if invite.IsOpen() || invite.Token == "" {
+		return ErrInviteNotResendable
+	}
+
+	body := fmt.Sprintf(`Hi,
+
+%s has invited you to join as %s. Create your account here:
+
+%s
+
+The link expires on %s.
+`, inviter.PublicName(), strings.ToLower(models.RoleName(invite.Role)),
+		s.InviteURL(invite.Token), invite.ExpiresAt.Format("January 2, 2006"))
+
+	err := s.app.Mailer.Send(mail.Message{
+		To:      invite.Email,
+		Subject: "You're invited",
+		Body:    body,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.app.Repos.Invites.MarkSent(ctx, invite.ID)
+}
+
+// ResendInvite issues a new link for a pending email invite and mails it. The
+// old link stops working, and the expiry restarts with the invite's original
+// validity period.
+func (s *AuthService) ResendInvite(ctx context.Context, id int, inviter *models.User) (*models.Invite, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.ResendInvite")
+	defer span.End()
+
+	token, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	invite, err := s.app.Repos.Invites.Reissue(ctx, id, HashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInviteNotResendable
+		}
+		return nil, err
+	}
+	invite.Token = token
+
+	if err := s.SendInvite(ctx, invite, inviter); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+func (s *AuthService) GetInvite(ctx context.Context, token string) (*models.Invite, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetInvite")
+	defer span.End()
+
+	// Looked up by hash, so timing can't leak the token (see GetSession)
+	invite, err := s.app.Repos.Invites.GetByTokenHash(ctx, HashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidInvite
+		}
+		return nil, err
+	}
+
+	invite.Token = token
+
+	if invite.IsExpired() || invite.IsRevoked() {
+		return nil, ErrInvalidInvite
+	}
+
+	if invite.IsUsed() {
+		return nil, ErrInviteAlreadyUsed
+	}
+
+	return invite, nil
+}
+
+type RegisterInput struct {
+	Email    string
+	Name     string
+	Password string
+}
+
+// Register creates an account through an invite, which must carry its
+// plaintext token as returned by GetInvite. The user, their password login
+// and one use of the invite are written in a single transaction, so if
+// another registration takes the last use first, or any step fails, no
+// account is left behind and the invite is untouched.
+func (s *AuthService) Register(ctx context.Context, invite *models.Invite, input RegisterInput) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Register")
+	defer span.End()
+
+	hash, err := HashPassword(input.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *models.User
+	err = s.app.InTx(ctx, func(repos *repository.Repositories) error {
+		slug, err := uniqueSlug(ctx, repos.Users, generateSlug(input.Name), 0)
+		if err != nil {
+			return err
+		}
+
+		user = &models.User{Email: input.Email, Name: input.Name, Role: invite.Role, Slug: slug}
+		if err := repos.Users.Create(ctx, user); err != nil {
+			if errors.Is(err, repository.ErrConflict) {
+				return ErrEmailTaken
+			}
+			return err
+		}
+
+		if err := repos.Logins.Create(ctx, newPasswordLogin(user.ID, input.Email, hash)); err != nil {
+			return err
+		}
+
+		// Takes a use of the invite and records who accepted it. The last
+		// use marks the invite used.
+		err = repos.Invites.Accept(ctx, HashToken(invite.Token), user.ID, input.Email)
+		if err == sql.ErrNoRows {
+			return ErrInvalidInvite
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *AuthService) GetPendingInvites(ctx context.Context) ([]models.Invite, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetPendingInvites")
+	defer span.End()
+	return s.app.Repos.Invites.ListPending(ctx)
+}
+
+// GetInviteHistory returns the most recent invites in any state, with who
+// sent each one and who registered through it.
+func (s *AuthService) GetInviteHistory(ctx context.Context, limit int) ([]models.Invite, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetInviteHistory")
+	defer span.End()
+	return s.app.Repos.Invites.History(ctx, limit)
+}
+
+// RevokeInvite stops a pending invite from being used. It stays in the
+// history.
+func (s *AuthService) RevokeInvite(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "AuthService.RevokeInvite")
+	defer span.End()
+	return s.app.Repos.Invites.Revoke(ctx, id)
+}
+
+// CleanExpiredInvites removes invites that expired or were revoked more than
+// retention ago without ever being accepted. Accepted invites are kept for the
+// history.
+func (s *AuthService) CleanExpiredInvites(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.CleanExpiredInvites")
+	defer span.End()
+	return s.app.Repos.Invites.DeleteExpired(ctx, time.Now().Add(-retention))
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/app"
+	"github.com/ioverpi/personal-site/internal/models"
+)
+
+// createTestInvite stores an invite for two registrations and returns it
+// with its plaintext token, as Register expects
+func createTestInvite(t *testing.T, a *app.App, invitedBy int) *models.Invite {
+	t.Helper()
+
+	const token = "test-invite-token"
+	invite := &models.Invite{
+		Role:      models.RoleAuthor,
+		TokenHash: HashToken(token),
+		InvitedBy: invitedBy,
+		MaxUses:   2,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := a.Repos.Invites.Create(context.Background(), invite); err != nil {
+		t.Fatal(err)
+	}
+	invite.Token = token
+	return invite
+}
+
+func TestRegister(t *testing.T) {
+	ctx := context.Background()
+	a := newTestApp(t)
+	admin := createTestUser(t, a, "admin@example.com", models.RoleAdmin)
+	invite := createTestInvite(t, a, admin.ID)
+
+	input := RegisterInput{Email: "new@example.com", Name: "New Author", Password: "violet tractor lantern"}
+	user, err := NewAuthService(a).Register(ctx, invite, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Repos.Logins.GetByProvider(ctx, models.ProviderPassword, input.Email); err != nil {
+		t.Errorf("password login: %v", err)
+	}
+	stored, err := a.Repos.Invites.GetByTokenHash(ctx, invite.TokenHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.UseCount != 1 {
+		t.Errorf("invite use count = %d, want 1", stored.UseCount)
+	}
+	if user.Role != invite.Role {
+		t.Errorf("user role = %q, want %q", user.Role, invite.Role)
+	}
+}
+
+// TestRegisterRollsBack breaks each step after the user is created and
+// checks that nothing Register wrote is left behind
+func TestRegisterRollsBack(t *testing.T) {
+	tests := []struct {
+		name      string
+		op, table string
+	}{
+		{"login", "INSERT", "logins"},
+		// Accept counts the use before recording the acceptance, so this
+		// fails after the invite has been updated
+		{"invite acceptance", "INSERT", "invite_acceptances"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			a := newTestApp(t)
+			admin := createTestUser(t, a, "admin@example.com", models.RoleAdmin)
+			invite := createTestInvite(t, a, admin.ID)
+			failStatement(t, a, tt.op, tt.table)
+
+			input := RegisterInput{Email: "new@example.com", Name: "New Author", Password: "violet tractor lantern"}
+			if _, err := NewAuthService(a).Register(ctx, invite, input); err == nil {
+				t.Fatal("Register succeeded, want the injected failure")
+			}
+
+			if _, err := a.Repos.Users.GetByEmail(ctx, input.Email); err != sql.ErrNoRows {
+				t.Errorf("user lookup: got %v, want sql.ErrNoRows", err)
+			}
+			if _, err := a.Repos.Logins.GetByProvider(ctx, models.ProviderPassword, input.Email); err != sql.ErrNoRows {
+				t.Errorf("login lookup: got %v, want sql.ErrNoRows", err)
+			}
+			stored, err := a.Repos.Invites.GetByTokenHash(ctx, invite.TokenHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.UseCount != 0 || stored.UsedAt != nil {
+				t.Errorf("invite use count = %d, used at %v, want unused", stored.UseCount, stored.UsedAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/ioverpi/personal-site/internal/adapters/mail"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/tracing"
+)
+
+// LoginLinkDuration is how long an emailed sign-in link stays valid
+const LoginLinkDuration = 15 * time.Minute
+
+var ErrInvalidLoginLink = errors.New("invalid or expired sign-in link")
+
+// SendLoginLink emails a single-use sign-in link to the account with this
+// email. To avoid revealing which addresses have accounts, it returns nil
+// when there is no such account or the owner has turned links off; only
+// throttling is reported, via ErrTooManyAttempts.
+func (s *AuthService) SendLoginLink(ctx context.Context, email, ipAddress string) error {
+	ctx, span := tracing.Start(ctx, "AuthService.SendLoginLink")
+	defer span.End()
+
+	blocked, err := s.isIPThrottled(ctx, ipAddress)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrTooManyAttempts
+	}
+
+	user, err := s.app.Repos.Users.GetByEmail(ctx, email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Counts towards the IP throttle so the form can't be used to
+			// probe for accounts at speed
+			s.recordLoginAttempt(ctx, email, ipAddress, false)
+			return nil
+		}
+		return err
+	}
+
+	if !user.MagicLinkEnabled || user.IsLocked() || user.IsDeactivated() {
+		return nil
+	}
+
+	token, err := GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	err = s.app.Repos.LoginLinks.Create(ctx, user.ID, HashToken(token), ipAddress, time.Now().Add(LoginLinkDuration))
+	if err != nil {
+		return err
+	}
+
+	link := s.app.Config.BaseURL + "/admin/login/link/confirm?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf(`Hi %s,
+
+Use this link to sign in. It works once and expires in %d minutes:
+
+%s
+
+The request came from %s. If it wasn't you, you can ignore this email.
+`, user.Name, int(LoginLinkDuration.Minutes()), link, ipAddress)
+
+	err = s.app.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body:    body,
+	})
+	if err != nil {
+		slog.Error("failed to send sign-in link", "user_id", user.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// ConsumeLoginLink redeems a sign-in link, returning its user. The link is
+// marked used whether or not sign-in then succeeds, and any other outstanding
+// links for the user are discarded. Attempts count towards the same per-IP
+// throttle as password logins.
+func (s *AuthService) ConsumeLoginLink(ctx context.Context, token, ipAddress string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.ConsumeLoginLink")
+	defer span.End()
+
+	user, err := s.consumeLoginLink(ctx, token, ipAddress)
+	countLogin("link", err)
+	return user, err
+}
+
+func (s *AuthService) consumeLoginLink(ctx context.Context, token, ipAddress string) (*models.User, error) {
+	blocked, err := s.isIPThrottled(ctx, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrTooManyAttempts
+	}
+
+	userID, err := s.app.Repos.LoginLinks.Consume(ctx, HashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			s.recordLoginAttempt(ctx, "", ipAddress, false)
+			return nil, ErrInvalidLoginLink
+		}
+		return nil, err
+	}
+
+	user, err := s.app.Repos.Users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.MagicLinkEnabled || user.IsDeactivated() {
+		s.recordLoginAttempt(ctx, user.Email, ipAddress, false)
+		return nil, ErrInvalidLoginLink
+	}
+	if user.IsLocked() {
+		s.recordLoginAttempt(ctx, user.Email, ipAddress, false)
+		return nil, ErrTooManyAttempts
+	}
+
+	s.recordLoginAttempt(ctx, user.Email, ipAddress, true)
+	if err := s.UnlockUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	if err := s.app.Repos.LoginLinks.DeleteUnused(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CleanExpiredLoginLinks removes links past their expiry
+func (s *AuthService) CleanExpiredLoginLinks(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "AuthService.CleanExpiredLoginLinks")
+	defer span.End()
+	return s.app.Repos.LoginLinks.DeleteExpired(ctx)
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ioverpi/personal-site/internal/app"
+)
+
+const (
+	// MinPasswordLength is the shortest password accepted when one is set or changed
+	MinPasswordLength = 8
+	// MaxPasswordLength is bcrypt's input limit, in bytes
+	MaxPasswordLength = 72
+)
+
+var (
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordTooLong  = errors.New("password is too long")
+	ErrPasswordCommon   = errors.New("password is too common")
+	ErrPasswordPersonal = errors.New("password matches account details")
+	ErrPasswordBreached = errors.New("password has appeared in a data breach")
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// commonPasswords is the bundled list, lower-cased
+var commonPasswords = parsePasswordList(commonPasswordList)
+
+// PasswordPolicy decides whether a new password is acceptable. Every place a
+// password is set (registration, account settings, cmd/seed) goes through it.
+type PasswordPolicy struct {
+	app *app.App
+}
+
+func NewPasswordPolicy(app *app.App) *PasswordPolicy {
+	return &PasswordPolicy{app: app}
+}
+
+// Check validates a new password. userInputs are account details such as the
+// email and name, which the password must not simply repeat.
+//
+// The breach range API, when configured, is consulted last. If it can't be
+// reached the password is accepted, so an outage doesn't block sign-ups.
+func (p *PasswordPolicy) Check(ctx context.Context, password string, userInputs ...string) error {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+	if len(password) > MaxPasswordLength {
+		return ErrPasswordTooLong
+	}
+
+	lower := strings.ToLower(password)
+	if _, ok := commonPasswords[lower]; ok {
+		return ErrPasswordCommon
+	}
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if input == "" {
+			continue
+		}
+		local, _, _ := strings.Cut(input, "@")
+		if lower == input || lower == local {
+			return ErrPasswordPersonal
+		}
+	}
+
+	if p.app.Breaches != nil {
+		count, err := p.app.Breaches.Count(ctx, password)
+		if err != nil {
+			slog.Warn("breached password check failed, skipping", "error", err)
+			return nil
+		}
+		if count > 0 {
+			return ErrPasswordBreached
+		}
+	}
+	return nil
+}
+
+func parsePasswordList(list string) map[string]struct{} {
+	passwords := map[string]struct{}{}
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+	return passwords
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ioverpi/personal-site/internal/adapters/breach"
+	"github.com/ioverpi/personal-site/internal/app"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := NewPasswordPolicy(&app.App{Breaches: breach.NewLocal("correct horse battery")})
+	inputs := []string{"jane.doe@example.com", "Jane Doe Smith"}
+
+	tests := []struct {
+		name     string
+		password string
+		want     error
+	}{
+		{"acceptable", "violet tractor lantern", nil},
+		{"minimum length", strings.Repeat("x", MinPasswordLength-1) + "y", nil},
+		{"too short", "x7!kq2", ErrPasswordTooShort},
+		{"too short in characters, not bytes", "ééééééé", ErrPasswordTooShort},
+		{"too long", strings.Repeat("x", MaxPasswordLength+1), ErrPasswordTooLong},
+		{"common", "password1", ErrPasswordCommon},
+		{"common in another case", "QwertyUIOP", ErrPasswordCommon},
+		{"email", "Jane.Doe@example.com", ErrPasswordPersonal},
+		{"email's local part", "jane.doe", ErrPasswordPersonal},
+		{"name", "jane doe smith", ErrPasswordPersonal},
+		{"breached", "correct horse battery", ErrPasswordBreached},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := policy.Check(context.Background(), tt.password, inputs...); err != tt.want {
+				t.Errorf("Check(%q) = %v, want %v", tt.password, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyIgnoresBlankInputs(t *testing.T) {
+	policy := NewPasswordPolicy(&app.App{})
+	if err := policy.Check(context.Background(), "violet tractor lantern", "", "  "); err != nil {
+		t.Errorf("Check = %v, want nil", err)
+	}
+}
+
+func TestPasswordPolicyBreachAPI(t *testing.T) {
+	local := breach.NewLocal("correct horse battery")
+	server := httptest.NewServer(local)
+	defer server.Close()
+
+	policy := NewPasswordPolicy(&app.App{Breaches: breach.NewRangeClient(server.URL)})
+	if err := policy.Check(context.Background(), "correct horse battery"); err != ErrPasswordBreached {
+		t.Errorf("breached password: got %v, want ErrPasswordBreached", err)
+	}
+	if err := policy.Check(context.Background(), "violet tractor lantern"); err != nil {
+		t.Errorf("unbreached password: got %v, want nil", err)
+	}
+}
+
+func TestPasswordPolicyBreachAPIOutage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// An outage must not block sign-ups, but the other rules still apply
+	policy := NewPasswordPolicy(&app.App{Breaches: breach.NewRangeClient(server.URL)})
+	if err := policy.Check(context.Background(), "correct horse battery"); err != nil {
+		t.Errorf("Check during an outage = %v, want nil", err)
+	}
+	if err := policy.Check(context.Background(), "password1"); err != ErrPasswordCommon {
+		t.Errorf("common password during an outage: got %v, want ErrPasswordCommon", err)
+	}
+
+	// Nor must an API that can't be reached at all
+	server.Close()
+	if err := policy.Check(context.Background(), "correct horse battery"); err != nil {
+		t.Errorf("Check with the API down = %v, want nil", err)
+	}
+}
@@ -1,11 +1,11 @@
 package services
 
 import (
-	"database/sql"
+	"context"
 
 	"github.com/ioverpi/personal-site/internal/app"
 	"github.com/ioverpi/personal-site/internal/models"
-	"github.com/lib/pq"
+	"github.com/ioverpi/personal-site/internal/tracing"
 )
 
 type ProjectsService struct {
@@ -16,50 +16,32 @@ func NewProjectsService(app *app.App) *ProjectsService {
 	return &ProjectsService{app: app}
 }
 
-func (s *ProjectsService) GetAllProjects() ([]models.Project, error) {
-	rows, err := s.app.DB.Query(`
-		SELECT id, name, description, tags, github_url, demo_url, display_order, created_at
-		FROM projects
-		ORDER BY display_order ASC, created_at DESC
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	return scanProjects(rows)
+func (s *ProjectsService) GetAllProjects(ctx context.Context) ([]models.Project, error) {
+	ctx, span := tracing.Start(ctx, "ProjectsService.GetAllProjects")
+	defer span.End()
+	return s.app.Repos.Projects.List(ctx)
 }
 
-func (s *ProjectsService) GetProjectByID(id int) (*models.Project, error) {
-	var project models.Project
-	err := s.app.DB.QueryRow(`
-		SELECT id, name, description, tags, github_url, demo_url, display_order, created_at
-		FROM projects
-		WHERE id = $1
-	`, id).Scan(
-		&project.ID, &project.Name, &project.Description,
-		pq.Array(&project.Tags), &project.GithubURL, &project.DemoURL,
-		&project.DisplayOrder, &project.CreatedAt,
-	)
+// GetProjectsPage returns one page of GetAllProjects and how many projects
+// there are in all. A page past the last is empty.
+func (s *ProjectsService) GetProjectsPage(ctx context.Context, page, perPage int) ([]models.Project, int, error) {
+	ctx, span := tracing.Start(ctx, "ProjectsService.GetProjectsPage")
+	defer span.End()
+
+	total, err := s.app.Repos.Projects.Count(ctx)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	offset, ok := pageOffset(page, perPage, total)
+	if !ok {
+		return nil, total, nil
 	}
-	return &project, nil
+	projects, err := s.app.Repos.Projects.ListPage(ctx, perPage, offset)
+	return projects, total, err
 }
 
-func scanProjects(rows *sql.Rows) ([]models.Project, error) {
-	var projects []models.Project
-	for rows.Next() {
-		var project models.Project
-		err := rows.Scan(
-			&project.ID, &project.Name, &project.Description,
-			pq.Array(&project.Tags), &project.GithubURL, &project.DemoURL,
-			&project.DisplayOrder, &project.CreatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		projects = append(projects, project)
-	}
-	return projects, rows.Err()
+func (s *ProjectsService) GetProjectByID(ctx context.Context, id int) (*models.Project, error) {
+	ctx, span := tracing.Start(ctx, "ProjectsService.GetProjectByID")
+	defer span.End()
+	return s.app.Repos.Projects.GetByID(ctx, id)
 }
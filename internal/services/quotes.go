@@ -1,11 +1,11 @@
 package services
 
 import (
-	"database/sql"
-	"math/rand"
+	"context"
 
 	"github.com/ioverpi/personal-site/internal/app"
 	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/tracing"
 )
 
 type QuotesService struct {
@@ -16,65 +16,38 @@ func NewQuotesService(app *app.App) *QuotesService {
 	return &QuotesService{app: app}
 }
 
-func (s *QuotesService) GetAllQuotes() ([]models.Quote, error) {
-	rows, err := s.app.DB.Query(`
-		SELECT id, content, author, is_own, created_at
-		FROM quotes
-		ORDER BY created_at DESC
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	return scanQuotes(rows)
+func (s *QuotesService) GetAllQuotes(ctx context.Context) ([]models.Quote, error) {
+	ctx, span := tracing.Start(ctx, "QuotesService.GetAllQuotes")
+	defer span.End()
+	return s.app.Repos.Quotes.List(ctx)
 }
 
-func (s *QuotesService) GetQuoteByID(id int) (*models.Quote, error) {
-	var quote models.Quote
-	err := s.app.DB.QueryRow(`
-		SELECT id, content, author, is_own, created_at
-		FROM quotes
-		WHERE id = $1
-	`, id).Scan(
-		&quote.ID, &quote.Content, &quote.Author, &quote.IsOwn, &quote.CreatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return &quote, nil
-}
+// GetQuotesPage returns one page of GetAllQuotes and how many quotes there
+// are in all. A page past the last is empty.
+func (s *QuotesService) GetQuotesPage(ctx context.Context, page, perPage int) ([]models.Quote, int, error) {
+	ctx, span := tracing.Start(ctx, "QuotesService.GetQuotesPage")
+	defer span.End()
 
-func (s *QuotesService) GetRandomQuote() (*models.Quote, error) {
-	var quote models.Quote
-	err := s.app.DB.QueryRow(`
-		SELECT id, content, author, is_own, created_at
-		FROM quotes
-		ORDER BY RANDOM()
-		LIMIT 1
-	`).Scan(
-		&quote.ID, &quote.Content, &quote.Author, &quote.IsOwn, &quote.CreatedAt,
-	)
+	total, err := s.app.Repos.Quotes.Count(ctx)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	offset, ok := pageOffset(page, perPage, total)
+	if !ok {
+		return nil, total, nil
 	}
-	return &quote, nil
+	quotes, err := s.app.Repos.Quotes.ListPage(ctx, perPage, offset)
+	return quotes, total, err
 }
 
-func scanQuotes(rows *sql.Rows) ([]models.Quote, error) {
-	var quotes []models.Quote
-	for rows.Next() {
-		var quote models.Quote
-		err := rows.Scan(
-			&quote.ID, &quote.Content, &quote.Author, &quote.IsOwn, &quote.CreatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		quotes = append(quotes, quote)
-	}
-	return quotes, rows.Err()
+func (s *QuotesService) GetQuoteByID(ctx context.Context, id int) (*models.Quote, error) {
+	ctx, span := tracing.Start(ctx, "QuotesService.GetQuoteByID")
+	defer span.End()
+	return s.app.Repos.Quotes.GetByID(ctx, id)
 }
 
-// Ensure rand is available for potential future use
-var _ = rand.Int
+func (s *QuotesService) GetRandomQuote(ctx context.Context) (*models.Quote, error) {
+	ctx, span := tracing.Start(ctx, "QuotesService.GetRandomQuote")
+	defer span.End()
+	return s.app.Repos.Quotes.Random(ctx)
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ioverpi/personal-site/internal/app"
+	"github.com/ioverpi/personal-site/internal/config"
+	"github.com/ioverpi/personal-site/internal/database"
+	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/migrations"
+)
+
+// newTestApp returns an app over a migrated in-memory SQLite database
+func newTestApp(t *testing.T) *app.App {
+	t.Helper()
+
+	database.MigrationsFS = migrations.FS
+	a, err := app.New(context.Background(), &config.Config{
+		DatabaseURL: "sqlite::memory:",
+		AutoMigrate: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(a.Close)
+	return a
+}
+
+// failStatement makes every op (INSERT, UPDATE or DELETE) on table fail, to
+// break a transaction part way through
+func failStatement(t *testing.T, a *app.App, op, table string) {
+	t.Helper()
+
+	_, err := a.DB.Exec(fmt.Sprintf(`
+		CREATE TRIGGER fail_%[1]s_%[2]s BEFORE %[1]s ON %[2]s
+		BEGIN SELECT RAISE(ABORT, 'injected failure'); END
+	`, op, table))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createTestUser(t *testing.T, a *app.App, email, role string) *models.User {
+	t.Helper()
+
+	user := &models.User{Email: email, Name: email, Role: role, Slug: generateSlug(email)}
+	if err := a.Repos.Users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
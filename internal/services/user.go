@@ -1,10 +1,22 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/ioverpi/personal-site/internal/app"
 	"github.com/ioverpi/personal-site/internal/models"
+	"github.com/ioverpi/personal-site/internal/repository"
+	"github.com/ioverpi/personal-site/internal/tracing"
+)
+
+var (
+	ErrInvalidAvatarURL = errors.New("avatar must be an https URL or a site path")
+	ErrInvalidReassign  = errors.New("posts must be reassigned to another active user")
 )
 
 type UserService struct {
@@ -15,65 +27,34 @@ func NewUserService(app *app.App) *UserService {
 	return &UserService{app: app}
 }
 
-func (s *UserService) GetByID(id int) (*models.User, error) {
-	var user models.User
-	err := s.app.DB.QueryRow(`
-		SELECT id, email, name, role, created_at, updated_at
-		FROM users
-		WHERE id = $1
-	`, id).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Role,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
-}
-
-func (s *UserService) GetByEmail(email string) (*models.User, error) {
-	var user models.User
-	err := s.app.DB.QueryRow(`
-		SELECT id, email, name, role, created_at, updated_at
-		FROM users
-		WHERE email = $1
-	`, email).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Role,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
+func (s *UserService) GetByID(ctx context.Context, id int) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetByID")
+	defer span.End()
+	return s.app.Repos.Users.GetByID(ctx, id)
 }
 
-func (s *UserService) GetAllUsers() ([]models.User, error) {
-	rows, err := s.app.DB.Query(`
-		SELECT id, email, name, role, created_at, updated_at
-		FROM users
-		ORDER BY created_at DESC
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+func (s *UserService) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetByEmail")
+	defer span.End()
+	return s.app.Repos.Users.GetByEmail(ctx, email)
+}
 
-	return scanUsers(rows)
+func (s *UserService) GetBySlug(ctx context.Context, slug string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetBySlug")
+	defer span.End()
+	return s.app.Repos.Users.GetBySlug(ctx, slug)
 }
 
-func (s *UserService) GetAdmins() ([]models.User, error) {
-	rows, err := s.app.DB.Query(`
-		SELECT id, email, name, role, created_at, updated_at
-		FROM users
-		WHERE role = 'admin'
-		ORDER BY created_at DESC
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+func (s *UserService) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetAllUsers")
+	defer span.End()
+	return s.app.Repos.Users.List(ctx)
+}
 
-	return scanUsers(rows)
+func (s *UserService) GetAdmins(ctx context.Context) ([]models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetAdmins")
+	defer span.End()
+	return s.app.Repos.Users.ListAdmins(ctx)
 }
 
 type CreateUserInput struct {
@@ -82,20 +63,20 @@ type CreateUserInput struct {
 	Role  string
 }
 
-func (s *UserService) CreateUser(input CreateUserInput) (*models.User, error) {
-	var user models.User
-	err := s.app.DB.QueryRow(`
-		INSERT INTO users (email, name, role)
-		VALUES ($1, $2, $3)
-		RETURNING id, email, name, role, created_at, updated_at
-	`, input.Email, input.Name, input.Role).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Role,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
+func (s *UserService) CreateUser(ctx context.Context, input CreateUserInput) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	defer span.End()
+
+	slug, err := uniqueSlug(ctx, s.app.Repos.Users, generateSlug(input.Name), 0)
 	if err != nil {
 		return nil, err
 	}
-	return &user, nil
+
+	user := &models.User{Email: input.Email, Name: input.Name, Role: input.Role, Slug: slug}
+	if err := s.app.Repos.Users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 type UpdateUserInput struct {
@@ -103,40 +84,164 @@ type UpdateUserInput struct {
 	Role string
 }
 
-func (s *UserService) UpdateUser(id int, input UpdateUserInput) (*models.User, error) {
-	var user models.User
-	err := s.app.DB.QueryRow(`
-		UPDATE users
-		SET name = $1, role = $2, updated_at = NOW()
-		WHERE id = $3
-		RETURNING id, email, name, role, created_at, updated_at
-	`, input.Name, input.Role, id).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Role,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
+func (s *UserService) UpdateUser(ctx context.Context, id int, input UpdateUserInput) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUser")
+	defer span.End()
+	return s.app.Repos.Users.Update(ctx, id, input.Name, input.Role)
+}
+
+type UpdateProfileInput struct {
+	Slug        string
+	DisplayName string
+	Bio         string
+	AvatarURL   string
+}
+
+func (s *UserService) UpdateProfile(ctx context.Context, id int, input UpdateProfileInput) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateProfile")
+	defer span.End()
+
+	base := generateSlug(input.Slug)
+	if base == "" {
+		base = generateSlug(input.DisplayName)
+	}
+	slug, err := uniqueSlug(ctx, s.app.Repos.Users, base, id)
 	if err != nil {
 		return nil, err
 	}
-	return &user, nil
+
+	var avatarURL *string
+	if input.AvatarURL != "" {
+		if !isImageURL(input.AvatarURL) {
+			return nil, ErrInvalidAvatarURL
+		}
+		avatarURL = &input.AvatarURL
+	}
+
+	return s.app.Repos.Users.UpdateProfile(ctx, id, repository.Profile{
+		Slug:        slug,
+		DisplayName: input.DisplayName,
+		Bio:         input.Bio,
+		AvatarURL:   avatarURL,
+	})
+}
+
+// SetMagicLinkEnabled turns emailed sign-in links on or off for the user
+func (s *UserService) SetMagicLinkEnabled(ctx context.Context, id int, enabled bool) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.SetMagicLinkEnabled")
+	defer span.End()
+	return s.app.Repos.Users.SetMagicLinkEnabled(ctx, id, enabled)
+}
+
+// Admin user management. Every change that could leave the site without an
+// active admin is checked inside the same transaction as the change.
+
+// ChangeRole sets a user's role. Demoting the last active admin fails.
+func (s *UserService) ChangeRole(ctx context.Context, id int, role string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.ChangeRole")
+	defer span.End()
+
+	if !models.IsValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+	return s.app.Repos.Users.ChangeRole(ctx, id, role)
 }
 
-func (s *UserService) DeleteUser(id int) error {
-	_, err := s.app.DB.Exec(`DELETE FROM users WHERE id = $1`, id)
-	return err
+// Deactivate blocks a user from signing in without touching their content.
+// Their sessions and outstanding sign-in links are removed; API tokens are
+// kept but refused while the account is deactivated.
+func (s *UserService) Deactivate(ctx context.Context, id int) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.Deactivate")
+	defer span.End()
+	return s.app.Repos.Users.Deactivate(ctx, id)
 }
 
-func scanUsers(rows *sql.Rows) ([]models.User, error) {
-	var users []models.User
-	for rows.Next() {
-		var user models.User
-		err := rows.Scan(
-			&user.ID, &user.Email, &user.Name, &user.Role,
-			&user.CreatedAt, &user.UpdatedAt,
-		)
+// Reactivate lets a deactivated user sign in again
+func (s *UserService) Reactivate(ctx context.Context, id int) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.Reactivate")
+	defer span.End()
+	return s.app.Repos.Users.Reactivate(ctx, id)
+}
+
+// CountPostsByAuthor counts posts, drafts included, written by the user
+func (s *UserService) CountPostsByAuthor(ctx context.Context, id int) (int, error) {
+	ctx, span := tracing.Start(ctx, "UserService.CountPostsByAuthor")
+	defer span.End()
+	return s.app.Repos.Posts.CountByAuthor(ctx, id)
+}
+
+// DeleteUser deletes a user. Their posts are reassigned to reassignTo, or kept
+// without an author when it is 0; either way the posts move and the user goes
+// in one transaction. Deleting the last active admin fails.
+func (s *UserService) DeleteUser(ctx context.Context, id, reassignTo int) error {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser")
+	defer span.End()
+
+	if reassignTo == id {
+		return ErrInvalidReassign
+	}
+
+	return s.app.InTx(ctx, func(repos *repository.Repositories) error {
+		if reassignTo != 0 {
+			target, err := repos.Users.GetByID(ctx, reassignTo)
+			if err == sql.ErrNoRows {
+				return ErrInvalidReassign
+			}
+			if err != nil {
+				return err
+			}
+			if target.IsDeactivated() {
+				return ErrInvalidReassign
+			}
+
+			if err := repos.Posts.Reassign(ctx, id, reassignTo); err != nil {
+				return err
+			}
+		}
+		return repos.Users.Delete(ctx, id)
+	})
+}
+
+// CountAdmins counts admins who can still sign in
+func (s *UserService) CountAdmins(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "UserService.CountAdmins")
+	defer span.End()
+	return s.app.Repos.Users.CountActiveAdmins(ctx)
+}
+
+// uniqueSlug returns base, or base with a numeric suffix, such that no user
+// other than exceptID already has it.
+func uniqueSlug(ctx context.Context, users repository.Users, base string, exceptID int) (string, error) {
+	if base == "" {
+		base = "user"
+	}
+
+	slug := base
+	for i := 2; ; i++ {
+		taken, err := users.SlugTaken(ctx, slug, exceptID)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
-		users = append(users, user)
+		if !taken {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// isImageURL accepts https URLs and absolute paths on this site. Browsers
+// read a backslash as a slash, so "/\evil.example" would load from another
+// host and backslashes are refused outright.
+func isImageURL(raw string) bool {
+	if strings.ContainsRune(raw, '\\') {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" && u.Host == "" {
+		return strings.HasPrefix(u.Path, "/")
 	}
-	return users, rows.Err()
+	return u.Scheme == "https" && u.Host != ""
 }
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ioverpi/personal-site/internal/app"
+	"github.com/ioverpi/personal-site/internal/models"
+)
+
+func createTestPost(t *testing.T, a *app.App, slug string, authorID int) *models.Post {
+	t.Helper()
+
+	post := &models.Post{Title: slug, Slug: slug, Content: "Content", AuthorID: &authorID}
+	if err := a.Repos.Posts.Create(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func TestDeleteUserReassignsPosts(t *testing.T) {
+	ctx := context.Background()
+	a := newTestApp(t)
+	createTestUser(t, a, "admin@example.com", models.RoleAdmin)
+	author := createTestUser(t, a, "author@example.com", models.RoleAuthor)
+	editor := createTestUser(t, a, "editor@example.com", models.RoleEditor)
+	post := createTestPost(t, a, "first", author.ID)
+
+	if err := NewUserService(a).DeleteUser(ctx, author.ID, editor.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := a.Repos.Posts.GetByID(ctx, post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AuthorID == nil || *got.AuthorID != editor.ID {
+		t.Errorf("post was not reassigned to %d", editor.ID)
+	}
+}
+
+// TestDeleteUserRollsBack fails the delete after the posts have been
+// reassigned, which must leave them with their original author
+func TestDeleteUserRollsBack(t *testing.T) {
+	ctx := context.Background()
+	a := newTestApp(t)
+	createTestUser(t, a, "admin@example.com", models.RoleAdmin)
+	author := createTestUser(t, a, "author@example.com", models.RoleAuthor)
+	editor := createTestUser(t, a, "editor@example.com", models.RoleEditor)
+	posts := []*models.Post{
+		createTestPost(t, a, "first", author.ID),
+		createTestPost(t, a, "second", author.ID),
+	}
+	failStatement(t, a, "DELETE", "users")
+
+	if err := NewUserService(a).DeleteUser(ctx, author.ID, editor.ID); err == nil {
+		t.Fatal("DeleteUser succeeded, want the injected failure")
+	}
+
+	if _, err := a.Repos.Users.GetByID(ctx, author.ID); err != nil {
+		t.Errorf("author lookup: %v", err)
+	}
+	for _, post := range posts {
+		got, err := a.Repos.Posts.GetByID(ctx, post.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.AuthorID == nil || *got.AuthorID != author.ID {
+			t.Errorf("post %q was reassigned, want it kept by %d", got.Slug, author.ID)
+		}
+	}
+}
+
+func TestIsImageURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want bool
+	}{
+		{"/static/avatar.png", true},
+		{"https://images.example.com/avatar.png", true},
+		{"http://images.example.com/avatar.png", false},
+		{"//evil.example/avatar.png", false},
+		{"/\\evil.example/avatar.png", false},
+		{"\\\\evil.example/avatar.png", false},
+		{"javascript:alert(1)", false},
+		{"avatar.png", false},
+		{"https:///avatar.png", false},
+	}
+	for _, tt := range tests {
+		if got := isImageURL(tt.raw); got != tt.want {
+			t.Errorf("isImageURL(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Package tracing sets up OpenTelemetry tracing and starts the site's spans.
+//
+// Requests get a span from middleware.Tracing, continuing the caller's trace
+// when it sends a W3C traceparent header. Service methods and database
+// queries start child spans with Start, so a trace shows where a request
+// spent its time. Without an exporter, spans aren't recorded, but trace IDs
+// from callers are still passed along and logged.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters accepted by NewExporter
+const (
+	ExporterNone = "none"
+	ExporterOTLP = "otlp"
+)
+
+const (
+	serviceName = "personal-site"
+	tracerName  = "github.com/ioverpi/personal-site"
+)
+
+// Start starts a span, as a child of the span in ctx if there is one
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// RecordError marks span as failed with err, if there is one
+func RecordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// NewExporter returns the exporter named by kind, or nil for "none". The
+// OTLP exporter sends over HTTP and is configured with the standard
+// OTEL_EXPORTER_OTLP_* environment variables, e.g.
+// OTEL_EXPORTER_OTLP_ENDPOINT=http://localhost:4318.
+func NewExporter(ctx context.Context, kind string) (sdktrace.SpanExporter, error) {
+	switch kind {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterOTLP:
+		return otlptracehttp.New(ctx)
+	}
+	return nil, fmt.Errorf("unknown trace exporter %q", kind)
+}
+
+// Setup installs the W3C trace context propagator and, when exporter isn't
+// nil, a tracer provider that batches spans to it. Sampling follows the
+// standard OTEL_TRACES_SAMPLER variables, recording every trace by default.
+// shutdown flushes any spans still waiting to be exported.
+func Setup(ctx context.Context, exporter sdktrace.SpanExporter) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
@@ -9,4 +9,7 @@ CREATE TABLE IF NOT EXISTS posts (
 );
 
 CREATE INDEX IF NOT EXISTS idx_posts_slug ON posts(slug);
-CREATE INDEX IF NOT EXISTS idx_posts_published_at ON posts(published_at);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_posts_published_at ON posts(published_at);
+
+-- +down
+DROP TABLE IF EXISTS posts;
@@ -9,4 +9,7 @@ CREATE TABLE IF NOT EXISTS projects (
     created_at TIMESTAMP NOT NULL DEFAULT NOW()
 );
 
-CREATE INDEX IF NOT EXISTS idx_projects_display_order ON projects(display_order);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_projects_display_order ON projects(display_order);
+
+-- +down
+DROP TABLE IF EXISTS projects;
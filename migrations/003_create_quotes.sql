@@ -7,3 +7,6 @@ CREATE TABLE IF NOT EXISTS quotes (
 );
 
 CREATE INDEX IF NOT EXISTS idx_quotes_is_own ON quotes(is_own);
+
+-- +down
+DROP TABLE IF EXISTS quotes;
@@ -8,4 +8,7 @@ CREATE TABLE IF NOT EXISTS users (
 );
 
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
-CREATE INDEX IF NOT EXISTS idx_users_role ON users(role);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_users_role ON users(role);
+
+-- +down
+DROP TABLE IF EXISTS users;
@@ -10,4 +10,7 @@ CREATE TABLE IF NOT EXISTS logins (
 );
 
 CREATE INDEX IF NOT EXISTS idx_logins_user_id ON logins(user_id);
-CREATE INDEX IF NOT EXISTS idx_logins_provider ON logins(provider, provider_id);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_logins_provider ON logins(provider, provider_id);
+
+-- +down
+DROP TABLE IF EXISTS logins;
@@ -9,4 +9,7 @@ CREATE TABLE IF NOT EXISTS invites (
 );
 
 CREATE INDEX IF NOT EXISTS idx_invites_token ON invites(token);
-CREATE INDEX IF NOT EXISTS idx_invites_email ON invites(email);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_invites_email ON invites(email);
+
+-- +down
+DROP TABLE IF EXISTS invites;
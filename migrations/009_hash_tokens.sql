@@ -0,0 +1,20 @@
+-- Tokens are now stored as SHA-256 hashes. Existing sessions hold plaintext
+-- tokens, so they are dropped and everyone signs in again.
+DELETE FROM sessions;
+ALTER TABLE sessions RENAME COLUMN token TO token_hash;
+ALTER INDEX IF EXISTS idx_sessions_token RENAME TO idx_sessions_token_hash;
+
+-- Invites are hashed in place so outstanding invite links keep working.
+UPDATE invites SET token = encode(sha256(token::bytea), 'hex');
+ALTER TABLE invites RENAME COLUMN token TO token_hash;
+ALTER INDEX IF EXISTS idx_invites_token RENAME TO idx_invites_token_hash;
+
+-- +down
+-- Hashes can't be reversed: sessions are dropped again, and invites sent
+-- before the rollback stop working.
+DELETE FROM sessions;
+ALTER INDEX IF EXISTS idx_sessions_token_hash RENAME TO idx_sessions_token;
+ALTER TABLE sessions RENAME COLUMN token_hash TO token;
+
+ALTER INDEX IF EXISTS idx_invites_token_hash RENAME TO idx_invites_token;
+ALTER TABLE invites RENAME COLUMN token_hash TO token;
@@ -0,0 +1,12 @@
+-- Users invited before roles existed could do everything an author can
+UPDATE users SET role = 'author' WHERE role = 'user';
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'viewer';
+
+ALTER TABLE invites ADD COLUMN IF NOT EXISTS role VARCHAR(50) NOT NULL DEFAULT 'author';
+
+-- +down
+-- Roles other than admin and author collapse back to the old 'user' role
+ALTER TABLE invites DROP COLUMN IF EXISTS role;
+
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'user';
+UPDATE users SET role = 'user' WHERE role <> 'admin';
@@ -0,0 +1,7 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS author_id INT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_posts_author_id ON posts(author_id);
+
+-- +down
+DROP INDEX IF EXISTS idx_posts_author_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS author_id;
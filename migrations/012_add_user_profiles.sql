@@ -0,0 +1,21 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS slug VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url VARCHAR(255);
+
+-- Backfill slugs from names, suffixing the ID where names collide or are empty
+UPDATE users SET slug = trim(both '-' from lower(regexp_replace(name, '[^a-zA-Z0-9]+', '-', 'g')))
+WHERE slug IS NULL;
+UPDATE users SET slug = 'user-' || id WHERE slug = '';
+UPDATE users u SET slug = u.slug || '-' || u.id
+WHERE EXISTS (SELECT 1 FROM users o WHERE o.slug = u.slug AND o.id < u.id);
+
+ALTER TABLE users ALTER COLUMN slug SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_slug ON users(slug);
+
+-- +down
+DROP INDEX IF EXISTS idx_users_slug;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
+ALTER TABLE users DROP COLUMN IF EXISTS slug;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS login_links (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_links_user_id ON login_links(user_id);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS magic_link_enabled BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- +down
+ALTER TABLE users DROP COLUMN IF EXISTS magic_link_enabled;
+
+DROP TABLE IF EXISTS login_links;
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMP;
+
+-- +down
+ALTER TABLE users DROP COLUMN IF EXISTS deactivated_at;
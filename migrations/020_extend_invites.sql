@@ -0,0 +1,49 @@
+-- Open invites (shareable codes) have no email and may be used several times.
+-- used_at now records when the last use was taken.
+ALTER TABLE invites ALTER COLUMN email DROP NOT NULL;
+ALTER TABLE invites ADD COLUMN IF NOT EXISTS max_uses INT NOT NULL DEFAULT 1;
+ALTER TABLE invites ADD COLUMN IF NOT EXISTS use_count INT NOT NULL DEFAULT 0;
+ALTER TABLE invites ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP;
+ALTER TABLE invites ADD COLUMN IF NOT EXISTS last_sent_at TIMESTAMP;
+
+-- Keep the history when the admin who sent an invite is deleted
+ALTER TABLE invites ALTER COLUMN invited_by DROP NOT NULL;
+ALTER TABLE invites DROP CONSTRAINT IF EXISTS invites_invited_by_fkey;
+ALTER TABLE invites ADD CONSTRAINT invites_invited_by_fkey
+    FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL;
+
+UPDATE invites SET use_count = 1 WHERE used_at IS NOT NULL AND use_count = 0;
+
+CREATE TABLE IF NOT EXISTS invite_acceptances (
+    id SERIAL PRIMARY KEY,
+    invite_id INT NOT NULL REFERENCES invites(id) ON DELETE CASCADE,
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    email VARCHAR(255) NOT NULL,
+    accepted_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_acceptances_invite_id ON invite_acceptances(invite_id);
+
+-- Invites accepted before this migration, matched to their account by email
+INSERT INTO invite_acceptances (invite_id, user_id, email, accepted_at)
+SELECT i.id, u.id, i.email, i.used_at
+FROM invites i
+LEFT JOIN users u ON u.email = i.email
+WHERE i.used_at IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM invite_acceptances a WHERE a.invite_id = i.id);
+
+-- +down
+DROP TABLE IF EXISTS invite_acceptances;
+
+-- Open invites and invites from deleted admins don't fit the old schema
+DELETE FROM invites WHERE email IS NULL OR invited_by IS NULL;
+ALTER TABLE invites DROP CONSTRAINT IF EXISTS invites_invited_by_fkey;
+ALTER TABLE invites ADD CONSTRAINT invites_invited_by_fkey
+    FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE invites ALTER COLUMN invited_by SET NOT NULL;
+
+ALTER TABLE invites DROP COLUMN IF EXISTS last_sent_at;
+ALTER TABLE invites DROP COLUMN IF EXISTS revoked_at;
+ALTER TABLE invites DROP COLUMN IF EXISTS use_count;
+ALTER TABLE invites DROP COLUMN IF EXISTS max_uses;
+ALTER TABLE invites ALTER COLUMN email SET NOT NULL;
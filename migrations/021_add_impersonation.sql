@@ -0,0 +1,13 @@
+-- An impersonation session signs an admin in as another user. It belongs to
+-- the impersonated user, so it ends with either account.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS impersonator_id INT REFERENCES users(id) ON DELETE CASCADE;
+
+-- Actions taken while impersonating are attributed to the impersonated user
+-- and also record the admin behind them
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS impersonator_email VARCHAR(255);
+
+-- +down
+ALTER TABLE audit_events DROP COLUMN IF EXISTS impersonator_email;
+
+DELETE FROM sessions WHERE impersonator_id IS NOT NULL;
+ALTER TABLE sessions DROP COLUMN IF EXISTS impersonator_id;
@@ -0,0 +1,25 @@
+-- History of background job runs. The unique index means each scheduled
+-- run happens once, however many replicas are running the scheduler.
+CREATE TABLE IF NOT EXISTS job_runs (
+    id SERIAL PRIMARY KEY,
+    job_name VARCHAR(100) NOT NULL,
+    scheduled_for TIMESTAMP NOT NULL,
+    instance VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    error TEXT,
+    started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_job_runs_job_scheduled ON job_runs(job_name, scheduled_for);
+CREATE INDEX IF NOT EXISTS idx_job_runs_started_at ON job_runs(started_at);
+
+-- Drafts can be scheduled to publish at a set time
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS scheduled_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled_at ON posts(scheduled_at) WHERE scheduled_at IS NOT NULL;
+
+-- +down
+DROP INDEX IF EXISTS idx_posts_scheduled_at;
+ALTER TABLE posts DROP COLUMN IF EXISTS scheduled_at;
+
+DROP TABLE IF EXISTS job_runs;
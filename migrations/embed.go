@@ -2,5 +2,7 @@ package migrations
 
 import "embed"
 
-//go:embed *.sql
+// FS holds the Postgres migrations, and SQLite's in the sqlite directory
+//
+//go:embed *.sql sqlite/*.sql
 var FS embed.FS
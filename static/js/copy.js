@@ -1,11 +1,11 @@
-// Run immediately since this script is loaded on the page that needs it
+// Run immediately since this script is loaded on the page that needs it.
+// Any button with data-copy-target="<input id>" copies that input's value.
 (function() {
-  const copyBtn = document.getElementById('copy-invite-btn');
-  if (copyBtn) {
-    copyBtn.addEventListener('click', function() {
-      const input = document.getElementById('invite-url');
+  document.querySelectorAll('[data-copy-target]').forEach(function(btn) {
+    btn.addEventListener('click', function() {
+      const input = document.getElementById(btn.dataset.copyTarget);
       input.select();
       navigator.clipboard.writeText(input.value);
     });
-  }
+  });
 })();